@@ -0,0 +1,243 @@
+package iwt
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/gildas/go-request"
+)
+
+// Callback describes a callback request, PureConnect will call the web user back
+type Callback struct {
+	ID            string         `json:"callbackID"`
+	ParticipantID string         `json:"participantID"`
+	Queue         *Queue         `json:"queue"`
+	Guest         Participant    `json:"guest"` // used to store the id of the guest on their platform (LINE, KKT, etc)
+	Telephone     string         `json:"telephone"`
+	Subject       string         `json:"subject"`
+	Language      string         `json:"language"`
+	Client        *Client        `json:"-"`
+	Logger        *logger.Logger `json:"-"`
+}
+
+// CreateCallbackOptions defines the options when creating a callback
+type CreateCallbackOptions struct {
+	Queue           *Queue            `json:"-"`
+	Guest           Participant       `json:"participant"`
+	Telephone       string            `json:"telephone"`
+	Subject         string            `json:"subject,omitempty"`
+	Language        string            `json:"language,omitempty"` // BCP-47 language tag(s) wanted by the web user, e.g. "fr-CA, fr;q=0.9"
+	Attributes      map[string]string `json:"attributes,omitempty"`
+	RoutingContexts []RoutingContext  `json:"routingContexts,omitempty"`
+	Identity        *Identity         `json:"-"` // if given, the callback is created for this registered web user
+}
+
+// ModifyCallbackOptions defines what can be modified in a callback
+type ModifyCallbackOptions struct {
+	Telephone string `json:"telephone,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+}
+
+// CallbackStatus describes the status of a callback request
+type CallbackStatus struct {
+	AssignedAgentName          string        `json:"assignedAgentName"`
+	AssignedAgentParticipantID string        `json:"assignedAgentParticipantID"`
+	InteractionState           string        `json:"interactionState"`
+	QueuePosition              int           `json:"queuePosition"`
+	QueueWaitTime              time.Duration `json:"queueWaitTime"`
+	EstimatedCallbackTime      time.Duration `json:"estimatedCallbackTime"`
+	LongestWaitTime            time.Duration `json:"longestWaitTime"`
+}
+
+type callbackRequest struct {
+	QueueName string    `json:"target"`
+	QueueType QueueType `json:"targettype"`
+	CreateCallbackOptions
+}
+
+type callbackResponse struct {
+	ID                         string `json:"callbackID"`
+	ParticipantID              string `json:"participantID"`
+	AssignedAgentName          string `json:"assignedAgentName,omitempty"`
+	AssignedAgentParticipantID string `json:"assignedAgentParticipantID,omitempty"`
+	InteractionState           string `json:"interactionState,omitempty"`
+	QueuePosition              int    `json:"queuePosition,omitempty"`
+	QueueWaitTime              int    `json:"queueWaitTime,omitempty"`         // in seconds => time.Duration
+	EstimatedCallbackTime      int    `json:"estimatedCallbackTime,omitempty"` // in seconds => time.Duration
+	LongestWaitTime            int    `json:"longestWaitTime,omitempty"`       // in seconds => time.Duration
+	Status                     Status `json:"status"`
+	Version                    int    `json:"cfgVer"`
+}
+
+func (callback *Callback) String() string {
+	return callback.ID
+}
+
+// post sends a POST request for this callback, in the language of the callback
+func (callback *Callback) post(ctx context.Context, path string, payload, results interface{}) (*request.Content, error) {
+	return callback.Client.send(ctx, http.MethodPost, path, callback.Language, payload, results)
+}
+
+// CreateCallback requests PureConnect to call the web user back
+func (client *Client) CreateCallback(ctx context.Context, options CreateCallbackOptions) (*Callback, error) {
+	log := client.Logger.Child("callback", "create")
+	if options.Queue == nil {
+		log.Errorf("Cannot create a callback without a queue")
+		return nil, errors.ArgumentMissing.With("queue")
+	}
+
+	callbackLanguage, err := client.negotiateLanguage(ctx, options.Language)
+	if err != nil {
+		return nil, err
+	}
+	options.Language = callbackLanguage
+
+	guest := options.Guest
+	if options.Identity != nil {
+		if len(guest.Name) == 0 {
+			guest.Name = options.Identity.Name
+		}
+		options.Guest = options.Identity.authenticate(options.Guest)
+	}
+
+	log.Debugf("Creating a Callback in %s", options.Queue.String())
+	results := struct {
+		Callback callbackResponse `json:"callback"`
+	}{}
+	_, err = client.send(ctx, http.MethodPost, "/callback/create", callbackLanguage,
+		callbackRequest{
+			options.Queue.Name,
+			options.Queue.Type,
+			options,
+		}, &results)
+	if err != nil {
+		return nil, err
+	}
+	if !results.Callback.Status.IsOK() {
+		return nil, results.Callback.Status.AsError()
+	}
+	callback := Callback{
+		ID:            results.Callback.ID,
+		ParticipantID: results.Callback.ParticipantID,
+		Queue:         options.Queue,
+		Guest:         guest,
+		Telephone:     options.Telephone,
+		Subject:       options.Subject,
+		Language:      options.Language,
+		Client:        client,
+		Logger:        client.Logger.Child("callback", "callback", "callback", results.Callback.ID),
+	}
+	callback.Logger.Infof("Callback created on queue %s for %s (%s)", callback.Queue, callback.Guest.Name, callback.Telephone)
+	return &callback, nil
+}
+
+// Status fetches the current status of the callback
+func (callback *Callback) Status(ctx context.Context) (*CallbackStatus, error) {
+	log := callback.Logger.Scope("status")
+	if len(callback.ParticipantID) == 0 {
+		log.Errorf("callback is not connected")
+		return nil, StatusNotConnectedEntity
+	}
+
+	log.Debugf("Requesting callback status...")
+	results := struct {
+		Callback callbackResponse `json:"callback"`
+	}{}
+	_, err := callback.post(ctx, "/callback/status/"+callback.ParticipantID, nil, &results)
+	if err != nil {
+		log.Errorf("Failed to send /callback/status request", err)
+		return nil, err
+	}
+	if !results.Callback.Status.IsOK() {
+		return nil, results.Callback.Status.Param("id", callback.ID).AsError()
+	}
+	return &CallbackStatus{
+		AssignedAgentName:          results.Callback.AssignedAgentName,
+		AssignedAgentParticipantID: results.Callback.AssignedAgentParticipantID,
+		InteractionState:           results.Callback.InteractionState,
+		QueuePosition:              results.Callback.QueuePosition,
+		QueueWaitTime:              time.Duration(results.Callback.QueueWaitTime) * time.Second,
+		EstimatedCallbackTime:      time.Duration(results.Callback.EstimatedCallbackTime) * time.Second,
+		LongestWaitTime:            time.Duration(results.Callback.LongestWaitTime) * time.Second,
+	}, nil
+}
+
+// Modify modifies the telephone number and/or the subject of the callback
+func (callback *Callback) Modify(ctx context.Context, options ModifyCallbackOptions) error {
+	log := callback.Logger.Scope("modify")
+	if len(callback.ParticipantID) == 0 {
+		log.Errorf("callback is not connected")
+		return StatusNotConnectedEntity
+	}
+
+	log.Debugf("Modifying callback...")
+	results := struct {
+		Callback callbackResponse `json:"callback"`
+	}{}
+	_, err := callback.post(ctx, "/callback/modify/"+callback.ParticipantID, options, &results)
+	if err != nil {
+		log.Errorf("Failed to send /callback/modify request", err)
+		return err
+	}
+	if !results.Callback.Status.IsOK() {
+		return results.Callback.Status.Param("id", callback.ID).AsError()
+	}
+	if len(options.Telephone) > 0 {
+		callback.Telephone = options.Telephone
+	}
+	if len(options.Subject) > 0 {
+		callback.Subject = options.Subject
+	}
+	return nil
+}
+
+// Disconnect cancels the callback request
+func (callback *Callback) Disconnect(ctx context.Context) error {
+	log := callback.Logger.Scope("disconnect")
+	if len(callback.ParticipantID) == 0 {
+		log.Debugf("Callback is already disconnected")
+		return nil
+	}
+
+	log.Debugf("Disconnecting callback...")
+	results := struct {
+		Callback callbackResponse `json:"callback"`
+	}{}
+	_, err := callback.post(ctx, "/callback/disconnect/"+callback.ParticipantID, nil, &results)
+	if err != nil {
+		log.Errorf("Failed to send /callback/disconnect request", err)
+		return err
+	}
+	if results.Callback.Status.IsOK() || results.Callback.Status.IsA(StatusUnknownEntitySession) {
+		callback.ParticipantID = ""
+		return nil
+	}
+	return results.Callback.Status.Param("id", callback.ID).AsError()
+}
+
+// Reconnect reconnects the callback to the current API endpoint (Switchover event, e.g.)
+func (callback *Callback) Reconnect(ctx context.Context) error {
+	log := callback.Logger.Scope("reconnect")
+
+	log.Debugf("Reconnecting callback to %s...", callback.Client.CurrentAPIEndpoint())
+	results := struct {
+		Callback callbackResponse `json:"callback"`
+	}{}
+	_, err := callback.post(ctx, "/callback/reconnect", struct {
+		ID string `json:"callbackID"`
+	}{callback.ID}, &results)
+	if err != nil {
+		log.Errorf("Failed to send /callback/reconnect request", err)
+		return err
+	}
+	if !results.Callback.Status.IsOK() {
+		return results.Callback.Status.Param("id", callback.ID).AsError()
+	}
+	if len(results.Callback.ParticipantID) > 0 {
+		callback.ParticipantID = results.Callback.ParticipantID
+	}
+	return nil
+}
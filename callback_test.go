@@ -0,0 +1,119 @@
+package iwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanCreateCallback(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	callback, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:      iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:      iwt.Participant{Name: "UnitTest"},
+		Telephone:  "+81-3-1234-5678",
+		Subject:    "Please call me",
+		Attributes: map[string]string{"source": "LINE"},
+	})
+	require.Nil(t, err, "Failed to create a callback, Error: %s", err)
+	require.NotNil(t, callback, "Callback is nil")
+	assert.NotEmpty(t, callback.ID)
+	assert.NotEmpty(t, callback.ParticipantID)
+
+	serverCallback := server.Callback(callback.ID)
+	require.NotNil(t, serverCallback, "The server does not know the callback %s", callback.ID)
+	assert.Equal(t, "UnitTest", serverCallback.GuestName)
+	assert.Equal(t, "+81-3-1234-5678", serverCallback.Telephone)
+	assert.Equal(t, "Please call me", serverCallback.Subject)
+	assert.Equal(t, "LINE", serverCallback.Attributes["source"])
+}
+
+func TestFailsCreateCallbackOnUnknownQueue(t *testing.T) {
+	_, client := newTestFixture(t, iwt.ClientOptions{})
+
+	_, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:     iwt.NewQueue("Workgroup Queue:Unknown"),
+		Guest:     iwt.Participant{Name: "UnitTest"},
+		Telephone: "+81-3-1234-5678",
+	})
+	require.NotNil(t, err, "Should fail to create a callback on an unknown queue")
+	assert.Equal(t, "error.websvc.unknownEntity.invalidQueue", err.Error())
+}
+
+func TestFailsCreateCallbackWithoutQueue(t *testing.T) {
+	_, client := newTestFixture(t, iwt.ClientOptions{})
+
+	_, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Guest:     iwt.Participant{Name: "UnitTest"},
+		Telephone: "+81-3-1234-5678",
+	})
+	require.NotNil(t, err, "Should fail to create a callback without a queue")
+	assert.ErrorIs(t, err, errors.ArgumentMissing)
+}
+
+func TestCanGetCallbackStatus(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	callback, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:     iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:     iwt.Participant{Name: "UnitTest"},
+		Telephone: "+81-3-1234-5678",
+	})
+	require.Nil(t, err, "Failed to create a callback, Error: %s", err)
+	serverCallback := server.Callback(callback.ID)
+	serverCallback.SetQueue(3, 120, 300)
+	serverCallback.AssignAgent("Bob Minion")
+
+	status, err := callback.Status(context.Background())
+	require.Nil(t, err, "Failed to get the callback status, Error: %s", err)
+	assert.Equal(t, "Bob Minion", status.AssignedAgentName)
+	assert.NotEmpty(t, status.AssignedAgentParticipantID)
+	assert.Equal(t, 3, status.QueuePosition)
+	assert.Equal(t, 2*time.Minute, status.QueueWaitTime)
+	assert.Equal(t, 5*time.Minute, status.EstimatedCallbackTime)
+}
+
+func TestCanModifyCallback(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	callback, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:     iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:     iwt.Participant{Name: "UnitTest"},
+		Telephone: "+81-3-1234-5678",
+	})
+	require.Nil(t, err, "Failed to create a callback, Error: %s", err)
+
+	err = callback.Modify(context.Background(), iwt.ModifyCallbackOptions{Telephone: "+81-3-8765-4321"})
+	require.Nil(t, err, "Failed to modify the callback, Error: %s", err)
+	assert.Equal(t, "+81-3-8765-4321", callback.Telephone)
+	assert.Equal(t, "+81-3-8765-4321", server.Callback(callback.ID).Telephone)
+}
+
+func TestCanDisconnectAndReconnectCallback(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	callback, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:     iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:     iwt.Participant{Name: "UnitTest"},
+		Telephone: "+81-3-1234-5678",
+	})
+	require.Nil(t, err, "Failed to create a callback, Error: %s", err)
+
+	err = callback.Reconnect(context.Background())
+	require.Nil(t, err, "Failed to reconnect the callback, Error: %s", err)
+	assert.Equal(t, 1, server.Callback(callback.ID).Reconnects())
+
+	err = callback.Disconnect(context.Background())
+	require.Nil(t, err, "Failed to disconnect the callback, Error: %s", err)
+	assert.True(t, server.Callback(callback.ID).IsDisconnected())
+	assert.Empty(t, callback.ParticipantID)
+
+	_, err = callback.Status(context.Background())
+	require.NotNil(t, err, "A disconnected callback should not have a status")
+}
@@ -1,44 +1,85 @@
 package iwt
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gildas/go-errors"
 	"github.com/gildas/go-logger"
 	"github.com/gildas/go-request"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Chat describes a live chat
+//
+// The Chat methods are safe to call from several goroutines.
+// Its exported fields are updated while the chat is live, use the Chat methods to read them safely.
 type Chat struct {
-	ID                 string         `json:"chatID"`
-	Queue              *Queue         `json:"queue"`
-	Participants       []Participant  `json:"participants"`
-	Guest              Participant    `json:"guest"` // used to store the id of the guest on their platform (LINE, KKT, etc)
-	PollWaitSuggestion time.Duration  `json:"pollWaitSuggestion"`
-	Language           string         `json:"language"`
-	DateFormat         string         `json:"dateFormat"`
-	TimeFormat         string         `json:"timeFormat"`
-	EventChan          chan ChatEvent `json:"-"`
-	PollTicker         *time.Ticker   `json:"-"`
-	Client             *Client        `json:"-"`
-	Logger             *logger.Logger `json:"-"`
+	ID                  string         `json:"chatID"`
+	Queue               *Queue         `json:"queue"`
+	Participants        []Participant  `json:"participants"`
+	Guest               Participant    `json:"guest"` // used to store the id of the guest on their platform (LINE, KKT, etc)
+	PollWaitSuggestion  time.Duration  `json:"pollWaitSuggestion"`
+	Language            string         `json:"language"` // as negotiated with PureConnect when the chat started
+	DateFormat          string         `json:"dateFormat"`
+	TimeFormat          string         `json:"timeFormat"`
+	ContentTypes        []string       `json:"contentTypes"`         // negotiated when the chat started
+	MaxMessageLength    int            `json:"maxMessageLength"`     // 0 means no limit
+	Conversation        int            `json:"conversation"`         // the ConversationSequenceNumber of the last message
+	NextSequenceNumbers map[int]int    `json:"nextSequenceNumbers"`  // indexed by conversation, the events before were already delivered
+	Transcript          *Transcript    `json:"transcript,omitempty"` // if attached, records the conversation
+	EventChan           chan ChatEvent `json:"-"`
+	Client              *Client        `json:"-"`
+	Logger              *logger.Logger `json:"-"`
+	typing              *typingIndicator
+	overflowPolicy      EventOverflowPolicy
+	handlers            ChatHandlers
+	uploadProgress      UploadProgressFunc
+	context             context.Context    // lives as long as the chat, canceled by Stop
+	cancel              context.CancelFunc // cancels context
+	pollCancel          context.CancelFunc // cancels the current polling
+	stopping            bool
+	outbox              []ChatEvent   // events waiting for room in EventChan, with BlockOnOverflow
+	outboxDone          chan struct{} // closed when the outbox is delivered, nil if the outbox is empty
+	outboxMutex         sync.Mutex
+	pendingEvents       map[sequence]ChatEvent // events received after a gap
+	deferredEvents      []chatEventWrapper     // events of the responses other than /chat/poll, processed by the next poll
+	gapAge              int                    // how many batches of events the current gap survived
+	startedAt           time.Time              // when StartChat started the chat, zero for resumed chats
+	agentJoined         bool                   // true once the first agent joined the chat
+	spanContext         trace.SpanContext      // of the StartChat span, linked from the poll spans
+	sequenceMutex       sync.Mutex             // serializes processEvents
+	mutex               sync.RWMutex
 }
 
 func (chat *Chat) String() string {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
 	return chat.ID
 }
 
 // StartChatOptions defines the options when starting a chat
 type StartChatOptions struct {
-	Queue                 *Queue            `json:"-"`
-	Guest                 Participant       `json:"participant"`
-	Language              string            `json:"language,omitempty"`
-	EmailAddress          string            `json:"emailAddress,omitempty"`
-	SupportedContentTypes string            `json:"supportedContentTypes"`
-	TranscriptRequired    bool              `json:"transcriptRequired"`
-	Attributes            map[string]string `json:"attributes,omitempty"`
-	RoutingContexts       []RoutingContext  `json:"routingContexts,omitempty"`
+	Queue                 *Queue              `json:"-"`
+	Guest                 Participant         `json:"participant"`
+	Language              string              `json:"language,omitempty"` // BCP-47 language tag(s) wanted by the web user, e.g. "fr-CA, fr;q=0.9"
+	EmailAddress          string              `json:"emailAddress,omitempty"`
+	SupportedContentTypes string              `json:"supportedContentTypes"` // comma separated, default: all the content types the library supports
+	TranscriptRequired    bool                `json:"transcriptRequired"`
+	Attributes            map[string]string   `json:"attributes,omitempty"`
+	RoutingContexts       []RoutingContext    `json:"routingContexts,omitempty"`
+	TypingDebounce        time.Duration       `json:"-"` // how often SetTyping(true) is sent to PureConnect, default: DefaultTypingDebounce
+	TypingIdleTimeout     time.Duration       `json:"-"` // when the web user is considered as having stopped typing, default: DefaultTypingIdleTimeout
+	EventBufferSize       int                 `json:"-"` // size of Chat.EventChan, default: DefaultEventBufferSize
+	OverflowPolicy        EventOverflowPolicy `json:"-"` // what to do when Chat.EventChan is full, default: BlockOnOverflow
+	Handlers              ChatHandlers        `json:"-"` // if given, the chat calls these instead of letting the caller read Chat.EventChan
+	OnUploadProgress      UploadProgressFunc  `json:"-"` // if given, called while Chat.SendFile sends a file
+	Transcript            *Transcript         `json:"-"` // if given, the conversation is recorded in it
+	Identity              *Identity           `json:"-"` // if given, the chat is started as this registered web user
 }
 
 // RoutingContext defines the routing context when starting a chat (see IWT documentation)
@@ -65,23 +106,93 @@ type chatResponse struct {
 }
 
 // IsWebUser tells if the given participantID is the customer (WebUser)
-func (chat Chat) IsWebUser(participantID string) bool {
+func (chat *Chat) IsWebUser(participantID string) bool {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
 	return len(chat.Participants) > 0 && participantID == chat.Participants[0].ID
 }
 
+// IsConnected tells if the chat is connected to PureConnect
+func (chat *Chat) IsConnected() bool {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	return len(chat.ID) > 0 && len(chat.Participants) > 0 && len(chat.Participants[0].ID) > 0
+}
+
+// Done returns a channel that is closed when the chat is stopped
+func (chat *Chat) Done() <-chan struct{} {
+	return chat.context.Done()
+}
+
+// webUser gives the chat identifier and the customer (WebUser)
+//
+// ok is false if the chat is not connected
+func (chat *Chat) webUser() (chatID string, participant Participant, ok bool) {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	if len(chat.ID) == 0 || len(chat.Participants) == 0 || len(chat.Participants[0].ID) == 0 {
+		return chat.ID, Participant{}, false
+	}
+	return chat.ID, chat.Participants[0], true
+}
+
+// post sends a POST request for this chat, in the language of the chat
+func (chat *Chat) post(ctx context.Context, path string, payload, results interface{}) (*request.Content, error) {
+	return chat.Client.send(ctx, http.MethodPost, path, chat.Language, payload, results)
+}
+
+// get sends a GET request for this chat, in the language of the chat
+func (chat *Chat) get(ctx context.Context, path string, results interface{}) (*request.Content, error) {
+	return chat.Client.send(ctx, http.MethodGet, path, chat.Language, nil, results)
+}
+
 // StartChat starts a chat
-// Chat Events will be sent to Chat.EventChan
-func (client *Client) StartChat(options StartChatOptions) (*Chat, error) {
+// Chat Events will be sent to Chat.EventChan, or to the Handlers if any was given in the options
+//
+// The given context is used to start the chat, the chat itself lives until Stop is called or the Client context is done.
+func (client *Client) StartChat(ctx context.Context, options StartChatOptions) (chat *Chat, err error) {
 	log := client.Logger.Child("chat", "start")
+	start := time.Now()
+	ctx, span := client.startSpan(ctx, "iwt.StartChat")
+	defer func() { endSpan(span, err) }()
+	if options.Queue == nil {
+		log.Errorf("Cannot start a chat without a queue")
+		return nil, errors.ArgumentMissing.With("queue")
+	}
+	span.SetAttributes(QueueAttribute.String(options.Queue.String()))
+
+	// Negotiating the content types with the server
+	serverContentTypes := []string{PlainTextContentType}
+	maxMessageLength := 0
+	if config, err := client.serverConfiguration(ctx); err == nil {
+		serverContentTypes = config.ContentTypes()
+		maxMessageLength = config.MaxMessageLength
+	} else {
+		log.Warnf("Failed to fetch the server configuration, using only %s: %s", PlainTextContentType, err)
+	}
+	contentTypes := negotiateContentTypes(options.SupportedContentTypes, serverContentTypes)
+	options.SupportedContentTypes = strings.Join(contentTypes, ",")
 
-	// Sanitizing options
-	options.SupportedContentTypes = "text/plain" // only supported types so far...
+	// Negotiating the language with the server
+	chatLanguage, err := client.negotiateLanguage(ctx, options.Language)
+	if err != nil {
+		return nil, err
+	}
+	options.Language = chatLanguage
+
+	guest := options.Guest
+	if options.Identity != nil {
+		if len(guest.Name) == 0 {
+			guest.Name = options.Identity.Name
+		}
+		options.Guest = options.Identity.authenticate(options.Guest)
+	}
 
 	log.Debugf("Starting a Chat in %s", options.Queue.String())
 	results := struct {
 		Chat chatResponse `json:"chat"`
 	}{}
-	_, err := client.post("/chat/start",
+	_, err = client.send(ctx, http.MethodPost, "/chat/start", chatLanguage,
 		chatRequest{
 			options.Queue.Name,
 			options.Queue.Type,
@@ -90,92 +201,191 @@ func (client *Client) StartChat(options StartChatOptions) (*Chat, error) {
 	if err != nil {
 		return nil, err
 	}
+	if !results.Chat.Status.IsOK() {
+		return nil, results.Chat.Status.AsError()
+	}
 	if results.Chat.PollWaitSuggestion < 1000 {
 		results.Chat.PollWaitSuggestion = 1000
 	}
-	chat := Chat{
+	span.SetAttributes(ChatIDAttribute.String(results.Chat.ID), ParticipantIDAttribute.String(results.Chat.ParticipantID))
+	chat = &Chat{
 		ID:                 results.Chat.ID,
 		Queue:              options.Queue,
-		Participants:       []Participant{{ID: results.Chat.ParticipantID, Name: options.Guest.Name, State: "active"}},
-		Guest:              options.Guest,
+		Participants:       []Participant{{Type: "WebUser", ID: results.Chat.ParticipantID, Name: guest.Name, State: "active"}},
+		Guest:              guest,
 		PollWaitSuggestion: time.Duration(results.Chat.PollWaitSuggestion) * time.Millisecond,
 		Language:           options.Language,
 		DateFormat:         results.Chat.DateFormat,
 		TimeFormat:         results.Chat.TimeFormat,
-		EventChan:          make(chan ChatEvent),
-		Client:             client,
-		Logger:             client.Logger.Child("chat", "chat", "chat", results.Chat.ID),
+		ContentTypes:       contentTypes,
+		MaxMessageLength:   maxMessageLength,
+		startedAt:          start,
+		spanContext:        span.SpanContext(),
+	}
+	// The events of the start response (the web user joining) are not delivered, but they count in the sequence
+	chat.NextSequenceNumbers = map[int]int{}
+	for _, event := range results.Chat.Events {
+		if key, ok := chat.sequenceOf(event.Event); ok && key.number >= chat.NextSequenceNumbers[key.conversation] {
+			chat.NextSequenceNumbers[key.conversation] = key.number + 1
+		}
 	}
+	chat.AttachTranscript(options.Transcript)
+	chat.bind(client, ResumeChatOptions{
+		TypingDebounce:    options.TypingDebounce,
+		TypingIdleTimeout: options.TypingIdleTimeout,
+		EventBufferSize:   options.EventBufferSize,
+		OverflowPolicy:    options.OverflowPolicy,
+		Handlers:          options.Handlers,
+		OnUploadProgress:  options.OnUploadProgress,
+	})
 	chat.Logger.Infof("Chat created on queue %s with %s (%s)", chat.Queue, chat.Participants[0].Name, chat.Participants[0].ID)
+	if !chat.handlers.IsEmpty() {
+		go chat.dispatchEvents()
+	}
 	chat.startPollingMessages()
-	return &chat, results.Chat.Status.AsError()
+	return chat, nil
 }
 
 // Stop stops the current chat
-func (chat *Chat) Stop() error {
+//
+// Stop can be called from several goroutines, only the first call stops the chat.
+// Stop does not wait for the StopEvent to be delivered: with the BlockOnOverflow policy, it goes to the outbox if Chat.EventChan is full.
+func (chat *Chat) Stop(ctx context.Context) (err error) {
 	log := chat.Logger.Scope("stop")
+	ctx, span := chat.startSpan(ctx, "iwt.Stop")
+	defer func() { endSpan(span, err) }()
 
-	if len(chat.ID) == 0 || len(chat.Participants) == 0 || len(chat.Participants[0].ID) == 0 {
+	chat.mutex.Lock()
+	if chat.stopping || len(chat.ID) == 0 || len(chat.Participants) == 0 || len(chat.Participants[0].ID) == 0 {
+		chat.mutex.Unlock()
 		log.Debugf("Chat is already stopped")
 		return nil
 	}
+	chat.stopping = true
+	chatID, participantID := chat.ID, chat.Participants[0].ID
+	chat.mutex.Unlock()
 
 	log.Debugf("Stopping chat...")
 	results := struct {
 		Chat chatResponse `json:"chat"`
 	}{}
-	_, err := chat.Client.post("/chat/exit/"+chat.Participants[0].ID, nil, &results)
+	_, err = chat.post(ctx, "/chat/exit/"+participantID, nil, &results)
 	if err != nil {
 		log.Errorf("Failed to send /chat/exit request", err)
+		chat.mutex.Lock()
+		chat.stopping = false
+		chat.mutex.Unlock()
+		return err
+	}
+	if err = chat.terminate(); err != nil {
 		return err
 	}
-	chat.stopPollingMessages()
-	chat.EventChan <- StopEvent{ChatID: chat.ID}
 	if results.Chat.Status.IsOK() || results.Chat.Status.IsA(StatusUnknownEntitySession) {
-		chat.ID = ""
 		return nil
 	}
-	return results.Chat.Status.AsError()
+	return results.Chat.Status.Param("id", chatID).AsError()
 }
 
-// Reconnect reconnects the current chat to another server (Switchover event, e.g.)
-func (chat *Chat) Reconnect() error {
+// terminate stops polling, emits the StopEvent and cancels the chat context
+func (chat *Chat) terminate() error {
+	chat.mutex.Lock()
+	if len(chat.ID) == 0 {
+		chat.mutex.Unlock()
+		return nil
+	}
+	chatID := chat.ID
+	chat.ID = ""
+	chat.mutex.Unlock()
+
+	chat.Client.unregisterChat(chat)
+	chat.stopPollingMessages()
+	chat.stopTyping()
+	err := chat.emit(StopEvent{ChatID: chatID})
+	chat.cancel()
+	return err
+}
+
+// Reconnect reconnects the current chat to the current API endpoint of the Client (after a switchover, e.g.)
+//
+// The Client reconnects its live chats when it switches over, there is usually no need to call Reconnect.
+func (chat *Chat) Reconnect(ctx context.Context) (err error) {
 	log := chat.Logger.Scope("reconnect")
+	ctx, span := chat.startSpan(ctx, "iwt.Reconnect")
+	defer func() { endSpan(span, err) }()
 
+	chatID, _, ok := chat.webUser()
+	if !ok {
+		log.Errorf("chat is not connected")
+		return StatusNotConnectedEntity
+	}
+	defer func() { chat.Client.Metrics.Reconnected(metricReason(err)) }()
 	chat.stopPollingMessages()
-	chat.Client.NextAPIEndpoint()
 	log.Debugf("Reconnecting chat to %s...", chat.Client.CurrentAPIEndpoint())
 	results := struct {
 		Chat chatResponse `json:"chat"`
 	}{}
-	_, err := chat.Client.post("/chat/reconnect", struct {
+	_, err = chat.post(ctx, "/chat/reconnect", struct {
 		ChatID string `json:"chatID"`
-	}{chat.ID}, &results)
-	if err != nil {
-		log.Errorf("Failed to send /chat/exit request", err)
+	}{chatID}, &results)
+	if err == nil {
+		chat.mutex.Lock()
+		if len(results.Chat.ParticipantID) > 0 && len(chat.Participants) > 0 {
+			chat.Participants[0].ID = results.Chat.ParticipantID
+		}
+		chat.mutex.Unlock()
+		chat.processEvents(results.Chat.Events)
+		err = results.Chat.Status.Param("id", chatID).AsError()
+	} else {
+		log.Errorf("Failed to send /chat/reconnect request", err)
+	}
+	if IsFatal(err) {
+		log.Errorf("Chat cannot be reconnected, stopping it", err)
+		_ = chat.terminate()
 		return err
 	}
-	chat.processEvents(results.Chat.Events)
+	// Even if the reconnect failed, polling tells the consumer when the chat is gone
 	chat.startPollingMessages()
-	return results.Chat.Status.Param("id", chat.ID).AsError()
+	return err
+}
+
+// switchover tells the chat consumer the Client switched to another API endpoint and reconnects the chat to it
+func (chat *Chat) switchover(from, to *url.URL) {
+	log := chat.Logger.Scope("switchover")
+
+	chatID, _, ok := chat.webUser()
+	if !ok {
+		log.Debugf("Chat is not connected, nothing to reconnect")
+		return
+	}
+	_ = chat.emit(SwitchoverEvent{ChatID: chatID, From: from.String(), To: to.String()})
+	if err := chat.Reconnect(chat.context); err != nil {
+		log.Errorf("Failed to reconnect to %s", to, err)
+	}
 }
 
 // SendMessage sends a message to the chat
-func (chat *Chat) SendMessage(text, contentType string) error {
+func (chat *Chat) SendMessage(ctx context.Context, text, contentType string) (err error) {
 	log := chat.Logger.Scope("sendmessage")
-	if len(chat.ID) == 0 {
+	ctx, span := chat.startSpan(ctx, "iwt.SendMessage")
+	defer func() { endSpan(span, err) }()
+	chatID, webUser, ok := chat.webUser()
+	if !ok {
 		log.Errorf("chat is not connected")
 		return StatusNotConnectedEntity
 	}
 	if len(contentType) == 0 {
-		contentType = "text/plain"
+		contentType = PlainTextContentType
+	}
+	if err := chat.validateMessage(text, contentType); err != nil {
+		log.Errorf("Cannot send the message", err)
+		return err
 	}
 
 	log.Debugf("Sending %s message...", contentType)
 	results := struct {
 		Chat chatResponse `json:"chat"`
 	}{}
-	_, err := chat.Client.post("/chat/sendMessage/"+chat.Participants[0].ID,
+	_, err = chat.post(ctx, "/chat/sendMessage/"+webUser.ID,
 		struct {
 			Message     string `json:"message"`
 			ContentType string `json:"contentType"`
@@ -185,130 +395,207 @@ func (chat *Chat) SendMessage(text, contentType string) error {
 		log.Errorf("Failed to send /chat/sendMessage request", err)
 		return err
 	}
-	go chat.processEvents(results.Chat.Events)
-	return results.Chat.Status.Param("id", chat.ID).AsError()
+	chat.deferEvents(results.Chat.Events)
+	return results.Chat.Status.Param("id", chatID).AsError()
 }
 
 // GetFileURL tells the Download URL for the given file path
-func (chat Chat) GetFileURL(path string) *url.URL {
+func (chat *Chat) GetFileURL(path string) *url.URL {
 	return chat.Client.URLWithPath(strings.TrimPrefix(path, "/websvcs"))
 }
 
 // GetFile download a file sent by an agent
-func (chat *Chat) GetFile(path string) (reader *request.Content, err error) {
+//
+// Deprecated: The file is read in memory and its name is lost, use DownloadFile instead.
+func (chat *Chat) GetFile(ctx context.Context, path string) (reader *request.Content, err error) {
 	log := chat.Logger.Scope("getfile")
-	if len(chat.ID) == 0 {
+	ctx, span := chat.startSpan(ctx, "iwt.GetFile")
+	defer func() { endSpan(span, err) }()
+	if !chat.IsConnected() {
 		log.Errorf("chat is not connected")
 		return nil, StatusNotConnectedEntity
 	}
 
 	log.Debugf("Requesting file...")
-	reader, err = chat.Client.get(strings.TrimPrefix(path, "/websvcs"), nil)
+	reader, err = chat.get(ctx, strings.TrimPrefix(path, "/websvcs"), nil)
 	if err != nil {
-		log.Errorf("Failed to send /chat/sendMessage request", err)
+		log.Errorf("Failed to send /chat/getfile request", err)
 		return
 	}
 	return
 }
 
+// startPollingMessages schedules the chat in the poll scheduler of its Client
+//
+// If the chat was already polling, its polling is restarted.
 func (chat *Chat) startPollingMessages() {
-	if chat.PollTicker != nil {
-		chat.stopPollingMessages()
-	}
-	chat.Logger.Scope("pollmessages").Infof("Polling messages every %s", chat.PollWaitSuggestion)
-	chat.PollTicker = time.NewTicker(chat.PollWaitSuggestion)
-
-	go func() {
-		log := chat.Logger.Scope("pollmessages")
-		for range chat.PollTicker.C {
-			if len(chat.Participants) == 0 {
-				log.Warnf("Chat has no participant...")
-				chat.stopPollingMessages()
-				chat.EventChan <- StopEvent{ChatID: chat.ID}
-				chat.ID = ""
-				return
-			}
-			if len(chat.Participants[0].ID) == 0 {
-				log.Errorf("Chat first participant has no ID... (name=%s, state=%s)", chat.Participants[0].Name, chat.Participants[0].State)
-				chat.stopPollingMessages()
-				chat.EventChan <- StopEvent{ChatID: chat.ID}
-				chat.ID = ""
-				return
-			}
-			log.Debugf("Polling messages for Participant %s (%s) %s", chat.Participants[0].Name, chat.Participants[0].ID, chat.Participants[0].State)
-			switch chat.Participants[0].State {
-			case "disconnected":
-				log.Infof("First participant disconnected, stopping chat")
-				chat.EventChan <- StopEvent{ChatID: chat.ID}
-				chat.stopPollingMessages()
-				chat.ID = ""
-				return
-			case "active":
-				results := struct {
-					Chat chatResponse `json:"chat"`
-				}{}
-				_, err := chat.Client.get("/chat/poll/"+chat.Participants[0].ID, &results)
-				if err == StatusUnavailableService.AsError() && len(chat.Client.APIEndpoints) > 1 {
-					log.Warnf("A Switchover happened!")
-					if err = chat.Reconnect(); err != nil {
-						log.Errorf("Failed to reconnect to backup server")
-					}
-					continue
-				}
-				if err != nil {
-					log.Errorf("Failed to send /chat/poll request", err)
-					continue
-				}
-				if results.Chat.Status.IsA(StatusUnknownEntitySession) {
-					log.Warnf("Zombie Chat, stopping it")
-					chat.stopPollingMessages()
-					chat.ID = ""
-					return
-				}
-				if !results.Chat.Status.IsOK() {
-					log.Errorf("Results contains an error", results.Chat.Status.AsError())
-					continue
-				}
-				chat.processEvents(results.Chat.Events)
-			default:
-				log.Warnf("Unsupported state %s for participant %s (%s)", chat.Participants[0].State, chat.Participants[0].Name, chat.Participants[0].ID)
-			}
+	chat.stopPollingMessages()
+
+	chat.mutex.Lock()
+	ctx, cancel := context.WithCancel(chat.context)
+	chat.pollCancel = cancel
+	interval := chat.PollWaitSuggestion
+	chat.mutex.Unlock()
+
+	chat.Logger.Scope("pollmessages").Infof("Polling messages every %s", interval)
+	chat.Client.pollScheduler.schedule(ctx, chat)
+}
+
+// pollMessages polls the messages of the chat once and tells if the chat should be polled again
+//
+// It is called by the poll scheduler of the Client, never twice at the same time for the same chat.
+func (chat *Chat) pollMessages(ctx context.Context) bool {
+	log := chat.Logger.Scope("pollmessages")
+	chat.mutex.RLock()
+	if len(chat.Participants) == 0 {
+		chat.mutex.RUnlock()
+		log.Warnf("Chat has no participant...")
+		_ = chat.terminate()
+		return false
+	}
+	webUser := chat.Participants[0]
+	chat.mutex.RUnlock()
+
+	if len(webUser.ID) == 0 {
+		log.Errorf("Chat first participant has no ID... (name=%s, state=%s)", webUser.Name, webUser.State)
+		_ = chat.terminate()
+		return false
+	}
+	log.Debugf("Polling messages for Participant %s (%s) %s", webUser.Name, webUser.ID, webUser.State)
+	switch webUser.State {
+	case "disconnected":
+		log.Infof("First participant disconnected, stopping chat")
+		_ = chat.terminate()
+		return false
+	case "active":
+		if chat.pendingOutbox() != nil {
+			log.Debugf("The consumer did not read the previous events yet, polling later")
+			return true
+		}
+		results := struct {
+			Chat chatResponse `json:"chat"`
+		}{}
+		pollCtx, span := chat.startSpan(ctx, "iwt.Poll", chat.startLink()...)
+		_, err := chat.get(pollCtx, "/chat/poll/"+webUser.ID, &results)
+		if ctx.Err() != nil {
+			log.Debugf("Polling context is done: %s", ctx.Err())
+			endSpan(span, ctx.Err())
+			return false
 		}
-	}()
+		if err == nil {
+			err = results.Chat.Status.AsError()
+		}
+		endSpan(span, err)
+		if err != nil {
+			chat.Client.Metrics.PollFailed(metricReason(err))
+		}
+		switch {
+		case err == nil:
+		case isEndpointFailure(err) && len(chat.Client.APIEndpoints) > 1:
+			log.Warnf("API endpoint %s failed, checking the health of all endpoints", chat.Client.CurrentAPIEndpoint())
+			// If the Client switches over, it reconnects this chat and this polling is canceled
+			chat.Client.checkHealthSoon()
+			return true
+		case errors.Is(err, StatusUnknownEntitySession):
+			log.Warnf("Zombie Chat, stopping it")
+			_ = chat.terminate()
+			return false
+		case IsFatal(err):
+			log.Errorf("Chat cannot continue, stopping it", err)
+			_ = chat.terminate()
+			return false
+		default:
+			log.Errorf("Failed to poll messages", err)
+			return true
+		}
+		chat.adaptPollWait(results.Chat.PollWaitSuggestion)
+		chat.processEvents(append(chat.takeDeferredEvents(), results.Chat.Events...))
+	default:
+		log.Warnf("Unsupported state %s for participant %s (%s)", webUser.State, webUser.Name, webUser.ID)
+	}
+	return true
+}
+
+// adaptPollWait uses the pollWaitSuggestion (in ms) PureConnect gave in its last response
+func (chat *Chat) adaptPollWait(suggestion int) {
+	if suggestion <= 0 {
+		return
+	}
+	interval := time.Duration(suggestion) * time.Millisecond
+	if interval < minPollWaitSuggestion {
+		interval = minPollWaitSuggestion
+	}
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if interval != chat.PollWaitSuggestion {
+		chat.Logger.Scope("pollmessages").Debugf("Polling messages every %s instead of %s", interval, chat.PollWaitSuggestion)
+		chat.PollWaitSuggestion = interval
+	}
 }
 
+// pollInterval gives the current interval between two polls of the chat
+func (chat *Chat) pollInterval() time.Duration {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	return chat.PollWaitSuggestion
+}
+
+// stopPollingMessages removes the chat from the poll scheduler of its Client
 func (chat *Chat) stopPollingMessages() {
-	if chat.PollTicker != nil {
-		chat.Logger.Scope("pollmessages").Debugf("stopping polling messages")
-		chat.PollTicker.Stop()
-		chat.Logger.Scope("pollmessages").Infof("stopped polling messages")
+	chat.mutex.Lock()
+	if chat.pollCancel == nil {
+		chat.mutex.Unlock()
+		return
 	}
-	chat.PollTicker = nil
+	chat.pollCancel()
+	chat.pollCancel = nil
+	chat.mutex.Unlock()
+
+	chat.Client.pollScheduler.unschedule(chat)
+	chat.Logger.Scope("pollmessages").Infof("stopped polling messages")
 }
 
 func (chat *Chat) processEvents(events []chatEventWrapper) {
 	log := chat.Logger.Scope("processevents")
 
-	for _, event := range events {
-		log.Record("event", event).Debugf("Emitting Event %s...", event.Event.GetType())
-		switch event.Event.GetType() {
-		case ParticipantStateChangedEvent{}.GetType():
-			evt := event.Event.(ParticipantStateChangedEvent)
-			if evt.Participant.State == "disconnected" {
-				chat.EventChan <- StopEvent{ChatID: chat.ID}
-			} else {
-				chat.EventChan <- event.Event
+	chat.sequenceMutex.Lock()
+	defer chat.sequenceMutex.Unlock()
+	for _, event := range chat.sequenceEvents(events) {
+		log.Record("event", event).Debugf("Emitting Event %s...", event.GetType())
+		chat.Client.Metrics.EventReceived(event.GetType())
+		chat.record(event)
+		switch evt := event.(type) {
+		case *ParticipantStateChangedEvent:
+			change := chat.updateRoster(evt)
+			if change != nil {
+				chat.record(*change)
+				chat.observeAgentWait(change)
+			}
+			_ = chat.emit(event)
+			if change != nil {
+				_ = chat.emit(*change)
 			}
-		case TextEvent{}.GetType():
-			evt := event.Event.(TextEvent)
+			if evt.Participant.State == "disconnected" && chat.IsWebUser(evt.Participant.ID) {
+				log.Infof("Web user disconnected, stopping chat")
+				_ = chat.terminate()
+				return
+			}
+		case *TextEvent:
 			if evt.Participant.Type == "WebUser" && chat.IsWebUser(evt.Participant.ID) {
 				log.Debugf("This is an echo of a message sent by the WebUser, ignoring it")
 				continue
 			} else {
-				chat.EventChan <- event.Event
+				_ = chat.emit(event)
+			}
+		case *FileEvent:
+			if evt.Participant.Type == "WebUser" && chat.IsWebUser(evt.Participant.ID) {
+				log.Debugf("This is an echo of a file sent by the WebUser, ignoring it")
+				continue
+			} else {
+				_ = chat.emit(event)
 			}
 		default:
-			chat.EventChan <- event.Event
+			_ = chat.emit(event)
 		}
 	}
 }
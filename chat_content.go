@@ -0,0 +1,194 @@
+package iwt
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// PlainTextContentType is the content type of plain text messages
+	PlainTextContentType = "text/plain"
+	// HTMLContentType is the content type of HTML messages
+	HTMLContentType = "text/html"
+	// URLContentType is the content type of URL messages
+	URLContentType = "text/uri-list"
+)
+
+// supportedContentTypes are the content types this library can send, in order of preference
+var supportedContentTypes = []string{PlainTextContentType, HTMLContentType, URLContentType}
+
+// allowedHTMLTags are the HTML tags kept by SanitizeHTML, with their allowed attributes
+var allowedHTMLTags = map[string][]string{
+	"a":          {"href"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"em":         nil,
+	"i":          nil,
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"pre":        nil,
+	"strong":     nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// SendText sends a plain text message to the chat
+func (chat *Chat) SendText(ctx context.Context, text string) error {
+	return chat.SendMessage(ctx, text, PlainTextContentType)
+}
+
+// SendHTML sends an HTML message to the chat
+//
+// The HTML is sanitized first (see SanitizeHTML).
+func (chat *Chat) SendHTML(ctx context.Context, source string) error {
+	return chat.SendMessage(ctx, SanitizeHTML(source), HTMLContentType)
+}
+
+// SendURL sends a URL message to the chat
+//
+// Only http and https URLs can be sent, other URLs fail with StatusInvalidContentType.
+func (chat *Chat) SendURL(ctx context.Context, link *url.URL) error {
+	if link == nil {
+		chat.Logger.Scope("sendurl").Errorf("No URL to send")
+		return StatusContentMissing.Param("contentType", URLContentType)
+	}
+	if (link.Scheme != "http" && link.Scheme != "https") || len(link.Host) == 0 {
+		chat.Logger.Scope("sendurl").Errorf("Invalid URL %s", link)
+		return StatusInvalidContentType.Param("contentType", URLContentType).Param("url", link.String())
+	}
+	return chat.SendMessage(ctx, link.String(), URLContentType)
+}
+
+// SupportsContentType tells if the given content type was negotiated for this chat
+func (chat *Chat) SupportsContentType(contentType string) bool {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	if len(chat.ContentTypes) == 0 {
+		return contentType == PlainTextContentType
+	}
+	return containsFold(chat.ContentTypes, contentType)
+}
+
+// validateMessage checks a message against the negotiated content types and the limits of the server
+func (chat *Chat) validateMessage(text, contentType string) error {
+	if !chat.SupportsContentType(contentType) {
+		return StatusInvalidContentType.Param("contentType", contentType)
+	}
+	if len(text) == 0 {
+		return StatusContentMissing.Param("contentType", contentType)
+	}
+	chat.mutex.RLock()
+	maxMessageLength := chat.MaxMessageLength
+	chat.mutex.RUnlock()
+	if length := len([]rune(text)); maxMessageLength > 0 && length > maxMessageLength {
+		return StatusContentTooLong.Param("length", length).Param("max", maxMessageLength)
+	}
+	return nil
+}
+
+// negotiateContentTypes gives the content types both the client and the server support
+//
+// requested is a comma separated list of content types, if empty all the supported content types are requested.
+// text/plain is always negotiated.
+func negotiateContentTypes(requested string, server []string) []string {
+	wanted := supportedContentTypes
+	if len(strings.TrimSpace(requested)) > 0 {
+		wanted = []string{}
+		for _, contentType := range strings.Split(requested, ",") {
+			wanted = append(wanted, strings.ToLower(strings.TrimSpace(contentType)))
+		}
+	}
+	negotiated := []string{PlainTextContentType}
+	for _, contentType := range wanted {
+		if contentType == PlainTextContentType || !containsFold(supportedContentTypes, contentType) || !containsFold(server, contentType) {
+			continue
+		}
+		negotiated = append(negotiated, contentType)
+	}
+	return negotiated
+}
+
+// containsFold tells if the value is in the values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeHTML keeps only the safe HTML tags and attributes of the given HTML source
+//
+// Formatting tags (b, i, p, lists, etc) are kept, links are kept if they are http, https, or mailto links.
+// Other tags are removed but their text is kept, except for script and style whose content is removed.
+func SanitizeHTML(source string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	sanitized := strings.Builder{}
+	skipping := 0 // how deep we are in script and style tags
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return sanitized.String()
+		case html.TextToken:
+			if skipping == 0 {
+				sanitized.WriteString(html.EscapeString(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "script" || token.Data == "style" {
+				if tokenType == html.StartTagToken {
+					skipping++
+				}
+				continue
+			}
+			attributes, allowed := allowedHTMLTags[token.Data]
+			if !allowed || skipping > 0 {
+				continue
+			}
+			sanitized.WriteString("<" + token.Data)
+			for _, attribute := range token.Attr {
+				if containsFold(attributes, attribute.Key) && isSafeLink(attribute.Val) {
+					sanitized.WriteString(" " + attribute.Key + `="` + html.EscapeString(attribute.Val) + `"`)
+				}
+			}
+			if tokenType == html.SelfClosingTagToken {
+				sanitized.WriteString("/>")
+			} else {
+				sanitized.WriteString(">")
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if token.Data == "script" || token.Data == "style" {
+				if skipping > 0 {
+					skipping--
+				}
+				continue
+			}
+			if _, allowed := allowedHTMLTags[token.Data]; allowed && skipping == 0 {
+				sanitized.WriteString("</" + token.Data + ">")
+			}
+		}
+	}
+}
+
+// isSafeLink tells if the given link can be kept in a sanitized HTML message
+func isSafeLink(link string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package iwt_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanNegotiateContentTypes(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/html"}
+	server.MaxMessageLength = 20
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	assert.Equal(t, []string{"text/plain", "text/html"}, chat.ContentTypes)
+	assert.Equal(t, []string{"text/plain", "text/html"}, serverChat.ContentTypes)
+	assert.Equal(t, 20, chat.MaxMessageLength)
+
+	err := chat.SendHTML(context.Background(), `<b onclick="steal()">Hello</b><script>steal()</script>`)
+	require.Nil(t, err, "Failed to send HTML, Error: %s", err)
+	err = chat.SendText(context.Background(), "Hello")
+	require.Nil(t, err, "Failed to send text, Error: %s", err)
+	messages := serverChat.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "<b>Hello</b>", messages[0].Text)
+	assert.Equal(t, "text/html", messages[0].ContentType)
+	assert.Equal(t, "Hello", messages[1].Text)
+	assert.Equal(t, "text/plain", messages[1].ContentType)
+
+	link, _ := url.Parse("https://www.genesys.com")
+	err = chat.SendURL(context.Background(), link)
+	assert.ErrorIs(t, err, iwt.StatusInvalidContentType, "URLs were not negotiated")
+	err = chat.SendText(context.Background(), "This message is way too long for this server")
+	assert.ErrorIs(t, err, iwt.StatusContentTooLong)
+	err = chat.SendText(context.Background(), "")
+	assert.ErrorIs(t, err, iwt.StatusContentMissing)
+	assert.Len(t, serverChat.Messages(), 2, "Invalid messages should not be sent")
+}
+
+func TestShouldNegotiatePlainTextByDefault(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	assert.Equal(t, []string{"text/plain"}, chat.ContentTypes)
+	assert.Equal(t, []string{"text/plain"}, serverChat.ContentTypes)
+	err := chat.SendHTML(context.Background(), "<b>Hello</b>")
+	assert.ErrorIs(t, err, iwt.StatusInvalidContentType)
+}
+
+func TestShouldNotKeepFailedServerConfiguration(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &iwt.NoRetry})
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/html"}
+
+	server.Fail("/serverConfiguration", iwttest.StatusUnavailable, 1)
+	_, err := client.GetServerConfiguration(context.Background())
+	assert.ErrorIs(t, err, iwt.StatusUnavailableService)
+
+	chat, _ := startTestChat(t, server, client, iwt.StartChatOptions{})
+	assert.Equal(t, []string{"text/plain", "text/html"}, chat.ContentTypes, "The failed configuration should not be used")
+	assert.Len(t, server.RequestsTo("/serverConfiguration"), 2)
+}
+
+func TestCanSendURL(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/uri-list"}
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	link, _ := url.Parse("https://www.genesys.com")
+	err := chat.SendURL(context.Background(), link)
+	require.Nil(t, err, "Failed to send URL, Error: %s", err)
+	messages := serverChat.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "https://www.genesys.com", messages[0].Text)
+	assert.Equal(t, "text/uri-list", messages[0].ContentType)
+
+	link, _ = url.Parse("javascript:alert(1)")
+	err = chat.SendURL(context.Background(), link)
+	assert.ErrorIs(t, err, iwt.StatusInvalidContentType)
+	require.IsType(t, iwt.Status{}, err)
+	assert.Equal(t, "javascript:alert(1)", err.(iwt.Status).Params["url"])
+	assert.Len(t, serverChat.Messages(), 1, "Invalid URLs should not be sent")
+}
+
+func TestCanSanitizeHTML(t *testing.T) {
+	tests := map[string]string{
+		`<p>Hello <b>World</b></p>`:                           `<p>Hello <b>World</b></p>`,
+		`<div class="x">Hello</div>`:                          `Hello`,
+		`Hello<script>alert("x")</script>`:                    `Hello`,
+		`<style>p { color: red }</style><i>styled</i>`:        `<i>styled</i>`,
+		`<a href="https://www.genesys.com">Genesys</a>`:       `<a href="https://www.genesys.com">Genesys</a>`,
+		`<a href="javascript:alert(1)">click</a>`:             `<a>click</a>`,
+		`<img src="x" onerror="alert(1)">`:                    ``,
+		`1 &lt; 2 &amp;&amp; <em>true</em>`:                   `1 &lt; 2 &amp;&amp; <em>true</em>`,
+		`line 1<br/>line 2`:                                   `line 1<br/>line 2`,
+		`<ul><li onmouseover="x()">one</li><li>two</li></ul>`: `<ul><li>one</li><li>two</li></ul>`,
+	}
+	for source, expected := range tests {
+		assert.Equal(t, expected, iwt.SanitizeHTML(source), "Source: %s", source)
+	}
+}
@@ -0,0 +1,401 @@
+package iwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// DefaultMaxDownloadSize is the maximum size of the files the client downloads, if not given in the ClientOptions
+const DefaultMaxDownloadSize = int64(50 * 1024 * 1024)
+
+// DefaultDownloadCacheMaxSize is the maximum size of the download cache, if not given in the ClientOptions
+const DefaultDownloadCacheMaxSize = int64(500 * 1024 * 1024)
+
+// FileDownload is a file being downloaded from PureConnect
+//
+// The caller must Close it when finished.
+type FileDownload struct {
+	io.ReadCloser
+	Name        string // the name of the file, as sent by the agent
+	ContentType string
+	Size        int64 // the size of the whole file, -1 if unknown
+	Offset      int64 // where the content starts in the file, 0 if the server could not resume the download
+	Cached      bool  // true if the file comes from the download cache of the Client
+}
+
+// DownloadFile downloads a file sent by an agent
+//
+// The file is streamed, it is not read in memory.
+// If the Client has a download cache, the file is read from the cache if it was already downloaded.
+func (chat *Chat) DownloadFile(ctx context.Context, event FileEvent) (*FileDownload, error) {
+	return chat.ResumeDownload(ctx, event, 0)
+}
+
+// ResumeDownload downloads a file sent by an agent, starting at the given offset
+//
+// This is typically used to resume a download that was interrupted.
+// If the server does not support ranges, the whole file is downloaded again and the Offset of the FileDownload is 0.
+func (chat *Chat) ResumeDownload(ctx context.Context, event FileEvent, offset int64) (download *FileDownload, err error) {
+	log := chat.Logger.Scope("downloadfile")
+	ctx, span := chat.startSpan(ctx, "iwt.DownloadFile")
+	defer func() { endSpan(span, err) }()
+	if !chat.IsConnected() {
+		log.Errorf("chat is not connected")
+		return nil, StatusNotConnectedEntity
+	}
+	if len(event.Path) == 0 {
+		return nil, errors.ArgumentMissing.With("path")
+	}
+	if offset < 0 {
+		return nil, errors.ArgumentInvalid.With("offset", offset)
+	}
+
+	cache := chat.Client.downloadCache
+	if cache != nil {
+		if download, found := cache.open(event.Path, offset); found {
+			log.Debugf("File %s found in the download cache", download.Name)
+			return download, nil
+		}
+	}
+
+	log.Debugf("Requesting file from offset %d...", offset)
+	// The file is streamed to the caller, so it is not sent with request.Send
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, chat.GetFileURL(event.Path).String(), nil)
+	if err != nil {
+		log.Errorf("Failed to create /chat/getfile request", err)
+		return nil, errors.WithStack(err)
+	}
+	headers := map[string]string{"User-Agent": "GENESYS IWT Client " + VERSION}
+	if len(chat.Language) > 0 {
+		headers["Accept-Language"] = chat.Language
+	}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+	injectTraceContext(ctx, headers)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	operation := operationOf(strings.TrimPrefix(event.Path, "/websvcs"))
+	start := time.Now()
+	res, err := (&http.Client{Transport: chat.Client.Transport}).Do(req)
+	if err != nil {
+		chat.Client.Metrics.ObserveRequest(operation, metricReason(err), time.Since(start))
+		log.Errorf("Failed to send /chat/getfile request", err)
+		return nil, errors.WithStack(err)
+	}
+	if res.StatusCode >= 400 {
+		chat.Client.Metrics.ObserveRequest(operation, metricReason(errors.FromHTTPStatusCode(res.StatusCode)), time.Since(start))
+	} else {
+		chat.Client.Metrics.ObserveRequest(operation, metricReason(nil), time.Since(start))
+	}
+
+	download = &FileDownload{
+		ReadCloser:  res.Body,
+		Name:        downloadedFileName(res.Header, event.Path),
+		ContentType: event.ContentType,
+		Size:        -1,
+		Offset:      offset,
+	}
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil {
+		download.ContentType = mediaType
+	}
+	switch {
+	case res.StatusCode == http.StatusPartialContent:
+		start, size, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			res.Body.Close()
+			log.Errorf("Invalid Content-Range %s for offset %d", res.Header.Get("Content-Range"), offset)
+			return nil, errors.ArgumentInvalid.With("Content-Range", res.Header.Get("Content-Range"))
+		}
+		download.Size = size
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		return nil, errors.ArgumentInvalid.With("offset", offset)
+	case res.StatusCode >= 400:
+		res.Body.Close()
+		log.Errorf("Failed to download file %s, HTTP Status: %s", download.Name, res.Status)
+		return nil, errors.FromHTTPStatusCode(res.StatusCode)
+	default:
+		if res.ContentLength >= 0 {
+			download.Size = res.ContentLength
+		}
+		if offset > 0 {
+			log.Warnf("The server does not support ranges, downloading %s from the start", download.Name)
+			download.Offset = 0
+		}
+	}
+
+	maxSize := chat.Client.MaxDownloadSize
+	if download.Size > maxSize {
+		res.Body.Close()
+		log.Errorf("File %s is too large (%d bytes, max: %d)", download.Name, download.Size, maxSize)
+		return nil, StatusContentTooLong.Param("name", download.Name).Param("size", download.Size).Param("max", maxSize)
+	}
+	download.ReadCloser = &maxSizeReader{ReadCloser: res.Body, name: download.Name, remaining: maxSize - download.Offset, max: maxSize}
+	if cache != nil && download.Offset == 0 {
+		download.ReadCloser = cache.store(event.Path, download)
+	}
+	return download, nil
+}
+
+// maxSizeReader fails when the file is larger than the maximum download size
+//
+// It is used when the server does not tell the size of the file.
+type maxSizeReader struct {
+	io.ReadCloser
+	name      string
+	remaining int64
+	max       int64
+}
+
+func (reader *maxSizeReader) Read(buffer []byte) (int, error) {
+	if reader.remaining < 0 {
+		return 0, StatusContentTooLong.Param("name", reader.name).Param("max", reader.max)
+	}
+	if int64(len(buffer)) > reader.remaining+1 {
+		buffer = buffer[:reader.remaining+1]
+	}
+	count, err := reader.ReadCloser.Read(buffer)
+	reader.remaining -= int64(count)
+	if reader.remaining < 0 {
+		return count, StatusContentTooLong.Param("name", reader.name).Param("max", reader.max)
+	}
+	return count, err
+}
+
+// downloadedFileName gives the name of a downloaded file from its Content-Disposition or from its path
+func downloadedFileName(header http.Header, filePath string) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && len(params["filename"]) > 0 {
+		return params["filename"]
+	}
+	return path.Base(filePath)
+}
+
+// parseContentRange parses a Content-Range header (e.g.: bytes 10-99/100)
+//
+// size is -1 if the server does not know the size of the file.
+func parseContentRange(contentRange string) (start, size int64, err error) {
+	unit, value, found := strings.Cut(contentRange, " ")
+	if !found || unit != "bytes" {
+		return 0, 0, errors.ArgumentInvalid.With("Content-Range", contentRange)
+	}
+	byteRange, total, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, errors.ArgumentInvalid.With("Content-Range", contentRange)
+	}
+	first, _, _ := strings.Cut(byteRange, "-")
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, errors.ArgumentInvalid.With("Content-Range", contentRange)
+	}
+	if total == "*" {
+		return start, -1, nil
+	}
+	if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+		return 0, 0, errors.ArgumentInvalid.With("Content-Range", contentRange)
+	}
+	return start, size, nil
+}
+
+// downloadCache keeps the downloaded files on disk, keyed by their path
+//
+// Each file is stored with its metadata in a JSON file next to it.
+// When the files are larger than maxSize, the least recently used ones are removed.
+type downloadCache struct {
+	directory string
+	maxSize   int64
+	mutex     sync.Mutex // serializes the evictions
+}
+
+// cachedFile describes a file of the download cache
+type cachedFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// newDownloadCache creates a download cache in the given directory
+func newDownloadCache(directory string, maxSize int64) (*downloadCache, error) {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &downloadCache{directory: directory, maxSize: maxSize}, nil
+}
+
+// filename gives the path of the cached file for the given download path
+func (cache *downloadCache) filename(filePath string) string {
+	sum := sha256.Sum256([]byte(filePath))
+	return filepath.Join(cache.directory, hex.EncodeToString(sum[:]))
+}
+
+// open opens a cached file at the given offset, found is false if the file is not in the cache
+func (cache *downloadCache) open(filePath string, offset int64) (download *FileDownload, found bool) {
+	filename := cache.filename(filePath)
+	payload, err := os.ReadFile(filename + ".json")
+	if err != nil {
+		return nil, false
+	}
+	metadata := cachedFile{}
+	if err := json.Unmarshal(payload, &metadata); err != nil {
+		return nil, false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, false
+	}
+	if info, err := file.Stat(); err != nil || info.Size() != metadata.Size || offset > metadata.Size {
+		file.Close()
+		return nil, false
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, false
+	}
+	touch(filename)
+	return &FileDownload{
+		ReadCloser:  file,
+		Name:        metadata.Name,
+		ContentType: metadata.ContentType,
+		Size:        metadata.Size,
+		Offset:      offset,
+		Cached:      true,
+	}, true
+}
+
+// evict removes the least recently used files until the cache is not larger than its maximum size
+func (cache *downloadCache) evict() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entries, err := os.ReadDir(cache.directory)
+	if err != nil {
+		return
+	}
+	files := []fs.FileInfo{}
+	total := int64(0)
+	for _, entry := range entries {
+		// only the cached files count, not their metadata or the downloads in progress
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), "download-") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+			total += info.Size()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, file := range files {
+		if total <= cache.maxSize {
+			return
+		}
+		filename := filepath.Join(cache.directory, file.Name())
+		_ = os.Remove(filename + ".json")
+		_ = os.Remove(filename)
+		total -= file.Size()
+	}
+}
+
+// touch marks a cached file as used now, the least recently used files are evicted first
+//
+// The time is set explicitly, as the modification times given by some file systems are too coarse to order the files.
+func touch(filename string) {
+	now := time.Now()
+	_ = os.Chtimes(filename, now, now)
+}
+
+// store gives a reader that stores the download in the cache as it is read
+//
+// The file is added to the cache only if it is read entirely.
+func (cache *downloadCache) store(filePath string, download *FileDownload) io.ReadCloser {
+	temp, err := os.CreateTemp(cache.directory, "download-*")
+	if err != nil {
+		return download.ReadCloser
+	}
+	return &cachingReader{
+		ReadCloser: download.ReadCloser,
+		cache:      cache,
+		temp:       temp,
+		filename:   cache.filename(filePath),
+		metadata:   cachedFile{Name: download.Name, ContentType: download.ContentType},
+	}
+}
+
+// cachingReader copies what it reads to a temporary file, which is added to the cache at the end of the download
+type cachingReader struct {
+	io.ReadCloser
+	cache    *downloadCache
+	temp     *os.File
+	filename string
+	metadata cachedFile
+}
+
+func (reader *cachingReader) Read(buffer []byte) (int, error) {
+	count, err := reader.ReadCloser.Read(buffer)
+	if reader.temp == nil {
+		return count, err
+	}
+	if count > 0 {
+		if _, werr := reader.temp.Write(buffer[:count]); werr != nil {
+			reader.discard()
+			return count, err
+		}
+		reader.metadata.Size += int64(count)
+	}
+	if err == io.EOF {
+		reader.commit()
+	} else if err != nil {
+		reader.discard()
+	}
+	return count, err
+}
+
+// Close closes the download, the file is not cached if it was not read entirely
+func (reader *cachingReader) Close() error {
+	if reader.temp != nil {
+		reader.discard()
+	}
+	return reader.ReadCloser.Close()
+}
+
+// commit adds the downloaded file to the cache
+func (reader *cachingReader) commit() {
+	temp := reader.temp
+	reader.temp = nil
+	if err := temp.Close(); err != nil {
+		_ = os.Remove(temp.Name())
+		return
+	}
+	if err := os.Rename(temp.Name(), reader.filename); err != nil {
+		_ = os.Remove(temp.Name())
+		return
+	}
+	touch(reader.filename)
+	if payload, err := json.Marshal(reader.metadata); err == nil {
+		_ = os.WriteFile(reader.filename+".json", payload, 0o600)
+	}
+	reader.cache.evict()
+}
+
+// discard removes the temporary file of an incomplete download
+func (reader *cachingReader) discard() {
+	temp := reader.temp
+	reader.temp = nil
+	temp.Close()
+	_ = os.Remove(temp.Name())
+}
@@ -0,0 +1,114 @@
+package iwt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanDownloadFile(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	serverChat.AddAgent("Bob Minion").SendFile("minion.png", "image/png", data)
+	event := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+
+	download, err := chat.DownloadFile(context.Background(), event)
+	require.Nil(t, err, "Failed to download file, Error: %s", err)
+	defer download.Close()
+	assert.Equal(t, "minion.png", download.Name)
+	assert.Equal(t, "image/png", download.ContentType)
+	assert.Equal(t, int64(len(data)), download.Size)
+	assert.False(t, download.Cached)
+	content, err := io.ReadAll(download)
+	require.Nil(t, err, "Failed to read file, Error: %s", err)
+	assert.Equal(t, data, content)
+
+	resumed, err := chat.ResumeDownload(context.Background(), event, 990)
+	require.Nil(t, err, "Failed to resume download, Error: %s", err)
+	defer resumed.Close()
+	assert.Equal(t, int64(990), resumed.Offset)
+	assert.Equal(t, int64(len(data)), resumed.Size)
+	content, err = io.ReadAll(resumed)
+	require.Nil(t, err, "Failed to read file, Error: %s", err)
+	assert.Equal(t, "0123456789", string(content))
+}
+
+func TestShouldDownloadWholeFileWhenServerIgnoresRange(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{MaxDownloadSize: 1000})
+	server.DisableRanges = true
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	serverChat.AddAgent("Bob Minion").SendFile("minion.png", "image/png", data)
+	event := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+
+	resumed, err := chat.ResumeDownload(context.Background(), event, 990)
+	require.Nil(t, err, "Failed to resume download, Error: %s", err)
+	defer resumed.Close()
+	assert.Equal(t, int64(0), resumed.Offset, "The download should start over")
+	assert.Equal(t, int64(len(data)), resumed.Size)
+	content, err := io.ReadAll(resumed)
+	require.Nil(t, err, "Failed to read file, Error: %s", err)
+	assert.Equal(t, data, content)
+}
+
+func TestShouldNotDownloadTooLargeFile(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{MaxDownloadSize: 100})
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	serverChat.AddAgent("Bob Minion").SendFile("minion.png", "image/png", bytes.Repeat([]byte("0123456789"), 100))
+	event := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+
+	_, err := chat.DownloadFile(context.Background(), event)
+	assert.ErrorIs(t, err, iwt.StatusContentTooLong)
+}
+
+func TestCanCacheDownloads(t *testing.T) {
+	metrics := iwt.NewPrometheusMetrics("iwt")
+	server, client := newTestFixture(t, iwt.ClientOptions{DownloadCacheDir: t.TempDir(), Metrics: metrics})
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	serverChat.AddAgent("Bob Minion").SendFile("minion.txt", "text/plain", []byte("Bello!"))
+	event := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		download, err := chat.DownloadFile(context.Background(), event)
+		require.Nil(t, err, "Failed to download file, Error: %s", err)
+		content, err := io.ReadAll(download)
+		require.Nil(t, err, "Failed to read file, Error: %s", err)
+		download.Close()
+		assert.Equal(t, "Bello!", string(content))
+		assert.Equal(t, "minion.txt", download.Name)
+		assert.Equal(t, "text/plain", download.ContentType)
+		assert.Equal(t, attempt > 0, download.Cached, "Only the first download should reach the server")
+	}
+	assert.Len(t, server.RequestsTo("/chat/getfile"), 1)
+	assert.Contains(t, scrapeMetrics(t, metrics), `iwt_requests_total{operation="chat/getfile",reason="success"} 1`+"\n")
+}
+
+func TestShouldEvictLeastRecentlyUsedDownloads(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{DownloadCacheDir: t.TempDir(), DownloadCacheMaxSize: 10})
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SendFile("minion.txt", "text/plain", []byte("Bello!"))
+	first := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+	agent.SendFile("banana.txt", "text/plain", []byte("Banana!!"))
+	second := *waitForEvent(t, chat, "file").(*iwt.FileEvent)
+
+	for _, event := range []iwt.FileEvent{first, second, first} {
+		download, err := chat.DownloadFile(context.Background(), event)
+		require.Nil(t, err, "Failed to download file, Error: %s", err)
+		_, err = io.ReadAll(download)
+		require.Nil(t, err, "Failed to read file, Error: %s", err)
+		download.Close()
+		assert.False(t, download.Cached, "%s should have been evicted from the cache", download.Name)
+	}
+	assert.Len(t, server.RequestsTo("/chat/getfile"), 3)
+}
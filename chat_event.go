@@ -14,6 +14,17 @@ type ChatEvent interface {
 	String() string
 }
 
+// chatEventRegistry gives the types of the events PureConnect sends, by their type
+var chatEventRegistry = core.TypeRegistry{}.Add(
+	FileEvent{},
+	ParticipantStateChangedEvent{},
+	StartEvent{},
+	StopEvent{},
+	TextEvent{},
+	TypingIndicatorEvent{},
+	URLEvent{},
+)
+
 // chatEventWrapper is used to Un/Marshal ChatEvent Objects
 type chatEventWrapper struct {
 	Event ChatEvent
@@ -39,16 +50,7 @@ func (wrapper *chatEventWrapper) UnmarshalJSON(payload []byte) (err error) {
 
 	var value ChatEvent
 
-	registry := core.TypeRegistry{}.Add(
-		FileEvent{},
-		ParticipantStateChangedEvent{},
-		StartEvent{},
-		StopEvent{},
-		TextEvent{},
-		TypingIndicatorEvent{},
-		URLEvent{},
-	)
-	if valueType, found := registry[header.Type]; found {
+	if valueType, found := chatEventRegistry[header.Type]; found {
 		value = reflect.New(valueType).Interface().(ChatEvent)
 	} else {
 		return errors.JSONUnmarshalError.Wrap(errors.Unsupported.With("type", header.Type))
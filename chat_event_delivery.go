@@ -0,0 +1,269 @@
+package iwt
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// DefaultEventBufferSize is the size of Chat.EventChan when StartChatOptions.EventBufferSize is not given
+const DefaultEventBufferSize = 32
+
+// outboxGracePeriod is how long the outbox waits for the consumer to read an event once the chat is done
+const outboxGracePeriod = 2 * time.Second
+
+// EventOverflowPolicy tells what to do when Chat.EventChan is full
+type EventOverflowPolicy int
+
+const (
+	// BlockOnOverflow keeps the events that do not fit in Chat.EventChan in an outbox and delivers them in order (default)
+	//
+	// The chat is not polled while its outbox is not empty, nothing is dropped as long as the consumer reads the events.
+	BlockOnOverflow EventOverflowPolicy = iota
+	// DropOldestOnOverflow drops the oldest event in Chat.EventChan to make room for the new one
+	DropOldestOnOverflow
+	// ErrorOnOverflow drops the new event and reports EventOverflowError
+	ErrorOnOverflow
+)
+
+func (overflowPolicy EventOverflowPolicy) String() string {
+	switch overflowPolicy {
+	case BlockOnOverflow:
+		return "block"
+	case DropOldestOnOverflow:
+		return "drop oldest"
+	case ErrorOnOverflow:
+		return "error"
+	default:
+		return fmt.Sprintf("EventOverflowPolicy(%d)", int(overflowPolicy))
+	}
+}
+
+// EventOverflowError is reported when an event cannot be delivered because Chat.EventChan is full
+var EventOverflowError = errors.NewSentinel(http.StatusInsufficientStorage, "error.iwt.event.overflow", "Event %s was dropped, the event channel is full")
+
+// ChatHandlers defines the functions called when a Chat receives events
+//
+// When at least one handler is given to StartChat, the Chat reads its own EventChan and calls the handlers in order,
+// the caller should not read Chat.EventChan.
+// Events without a handler are ignored.
+type ChatHandlers struct {
+	OnText               func(chat *Chat, event *TextEvent)
+	OnFile               func(chat *Chat, event *FileEvent)
+	OnURL                func(chat *Chat, event *URLEvent)
+	OnTyping             func(chat *Chat, event *TypingIndicatorEvent)
+	OnParticipantChanged func(chat *Chat, event *ParticipantStateChangedEvent)
+	OnStop               func(chat *Chat, event StopEvent)
+	OnSwitchover         func(chat *Chat, event SwitchoverEvent)
+	OnGapDetected        func(chat *Chat, event GapDetectedEvent)
+	OnRosterChanged      func(chat *Chat, event RosterChangedEvent)
+	OnError              func(chat *Chat, err error) // called when an event could not be delivered
+}
+
+// IsEmpty tells if no handler was given
+func (handlers ChatHandlers) IsEmpty() bool {
+	return handlers.OnText == nil &&
+		handlers.OnFile == nil &&
+		handlers.OnURL == nil &&
+		handlers.OnTyping == nil &&
+		handlers.OnParticipantChanged == nil &&
+		handlers.OnStop == nil &&
+		handlers.OnSwitchover == nil &&
+		handlers.OnGapDetected == nil &&
+		handlers.OnRosterChanged == nil
+}
+
+// emit sends an event to the EventChan according to the overflow policy
+//
+// emit never blocks, so the poll workers are never held by a slow consumer.
+// With BlockOnOverflow, the events that do not fit in the EventChan wait in the outbox of the chat,
+// they are delivered in order as the consumer reads the EventChan, and the chat is not polled meanwhile.
+func (chat *Chat) emit(event ChatEvent) error {
+	log := chat.Logger.Scope("emit")
+
+	switch chat.overflowPolicy {
+	case DropOldestOnOverflow:
+		for {
+			select {
+			case chat.EventChan <- event:
+				return nil
+			default:
+			}
+			select {
+			case dropped := <-chat.EventChan:
+				log.Warnf("Event channel is full, dropped the oldest event %s", dropped.GetType())
+			default:
+			}
+		}
+	case ErrorOnOverflow:
+		select {
+		case chat.EventChan <- event:
+			return nil
+		default:
+			err := EventOverflowError.With(event.GetType())
+			log.Errorf("Event channel is full", err)
+			if chat.handlers.OnError != nil {
+				chat.handlers.OnError(chat, err)
+			}
+			return err
+		}
+	default:
+		chat.outboxMutex.Lock()
+		defer chat.outboxMutex.Unlock()
+		if chat.outboxDone == nil {
+			select {
+			case chat.EventChan <- event:
+				return nil
+			default:
+			}
+			log.Debugf("Event channel is full, event %s will be delivered when the consumer reads it", event.GetType())
+			chat.outboxDone = make(chan struct{})
+			go chat.deliverOutbox(chat.outboxDone)
+		}
+		chat.outbox = append(chat.outbox, event)
+		return nil
+	}
+}
+
+// deliverOutbox sends the events of the outbox to the EventChan, in order, until the outbox is empty
+//
+// Once the chat is done, the consumer has outboxGracePeriod to read each event that is left (e.g. the StopEvent),
+// after that, or when the Client context is done, the outbox is dropped. done is closed when it stops.
+func (chat *Chat) deliverOutbox(done chan struct{}) {
+	defer close(done)
+	for {
+		chat.outboxMutex.Lock()
+		if len(chat.outbox) == 0 {
+			chat.outboxDone = nil
+			chat.outboxMutex.Unlock()
+			return
+		}
+		event := chat.outbox[0]
+		chat.outbox[0] = nil
+		chat.outbox = chat.outbox[1:]
+		chat.outboxMutex.Unlock()
+
+		if chat.deliver(event) {
+			continue
+		}
+		chat.outboxMutex.Lock()
+		chat.Logger.Scope("emit").Warnf("Nobody reads the events anymore, %d events were not delivered", len(chat.outbox)+1)
+		chat.outbox = nil
+		chat.outboxDone = nil
+		chat.outboxMutex.Unlock()
+		return
+	}
+}
+
+// deliver sends an event of the outbox to the EventChan, it gives false if the event could not be delivered
+func (chat *Chat) deliver(event ChatEvent) bool {
+	select {
+	case chat.EventChan <- event:
+		return true
+	case <-chat.Client.Context.Done():
+		return false
+	case <-chat.context.Done():
+		select {
+		case chat.EventChan <- event:
+			return true
+		case <-chat.Client.Context.Done():
+			return false
+		case <-time.After(outboxGracePeriod):
+			return false
+		}
+	}
+}
+
+// pendingOutbox gives a channel that is closed when the outbox is delivered, nil if the outbox is empty
+func (chat *Chat) pendingOutbox() <-chan struct{} {
+	chat.outboxMutex.Lock()
+	defer chat.outboxMutex.Unlock()
+	if chat.outboxDone == nil {
+		return nil
+	}
+	return chat.outboxDone
+}
+
+// dispatchEvents reads the EventChan and calls the handlers, until the chat is done
+func (chat *Chat) dispatchEvents() {
+	log := chat.Logger.Scope("dispatch")
+	for {
+		select {
+		case event := <-chat.EventChan:
+			chat.dispatch(event)
+		case <-chat.context.Done():
+			// Deliver the events that are still in the channel or in the outbox (e.g.: the StopEvent)
+			for {
+				select {
+				case event := <-chat.EventChan:
+					chat.dispatch(event)
+					continue
+				default:
+				}
+				pending := chat.pendingOutbox()
+				if pending == nil {
+					log.Debugf("Chat is done, stopped dispatching events")
+					return
+				}
+				select {
+				case event := <-chat.EventChan:
+					chat.dispatch(event)
+				case <-pending:
+				}
+			}
+		}
+	}
+}
+
+func (chat *Chat) dispatch(event ChatEvent) {
+	switch evt := event.(type) {
+	case *TextEvent:
+		if chat.handlers.OnText != nil {
+			chat.handlers.OnText(chat, evt)
+			return
+		}
+	case *FileEvent:
+		if chat.handlers.OnFile != nil {
+			chat.handlers.OnFile(chat, evt)
+			return
+		}
+	case *URLEvent:
+		if chat.handlers.OnURL != nil {
+			chat.handlers.OnURL(chat, evt)
+			return
+		}
+	case *TypingIndicatorEvent:
+		if chat.handlers.OnTyping != nil {
+			chat.handlers.OnTyping(chat, evt)
+			return
+		}
+	case *ParticipantStateChangedEvent:
+		if chat.handlers.OnParticipantChanged != nil {
+			chat.handlers.OnParticipantChanged(chat, evt)
+			return
+		}
+	case StopEvent:
+		if chat.handlers.OnStop != nil {
+			chat.handlers.OnStop(chat, evt)
+			return
+		}
+	case SwitchoverEvent:
+		if chat.handlers.OnSwitchover != nil {
+			chat.handlers.OnSwitchover(chat, evt)
+			return
+		}
+	case GapDetectedEvent:
+		if chat.handlers.OnGapDetected != nil {
+			chat.handlers.OnGapDetected(chat, evt)
+			return
+		}
+	case RosterChangedEvent:
+		if chat.handlers.OnRosterChanged != nil {
+			chat.handlers.OnRosterChanged(chat, evt)
+			return
+		}
+	}
+	chat.Logger.Scope("dispatch").Debugf("No handler for event %s, ignoring it", event.GetType())
+}
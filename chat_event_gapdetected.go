@@ -0,0 +1,40 @@
+package iwt
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gildas/go-errors"
+)
+
+// GapDetectedEvent is sent when some events of the chat were never received
+//
+// The events from sequence number From to To (included) of the conversation are missing.
+type GapDetectedEvent struct {
+	ChatID       string `json:"chatID"`
+	Conversation int    `json:"conversation"` // the ConversationSequenceNumber of the missing events
+	From         int    `json:"from"`
+	To           int    `json:"to"`
+}
+
+// GetType returns the type of this event
+func (event GapDetectedEvent) GetType() string {
+	return "gapDetected"
+}
+
+func (event GapDetectedEvent) String() string {
+	return "gap detected from " + strconv.Itoa(event.From) + " to " + strconv.Itoa(event.To) + " in conversation " + strconv.Itoa(event.Conversation)
+}
+
+// MarshalJSON encodes into JSON
+func (event GapDetectedEvent) MarshalJSON() ([]byte, error) {
+	type surrogate GapDetectedEvent
+	payload, err := json.Marshal(struct {
+		surrogate
+		Type string `json:"type"`
+	}{
+		surrogate(event),
+		event.GetType(),
+	})
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
@@ -0,0 +1,51 @@
+package iwt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gildas/go-errors"
+)
+
+// RosterChange tells how a participant changed in the roster of a chat
+type RosterChange string
+
+const (
+	// ParticipantJoined is used when a participant joined the chat
+	ParticipantJoined RosterChange = "joined"
+	// ParticipantLeft is used when a participant disconnected from the chat
+	ParticipantLeft RosterChange = "left"
+	// ParticipantUpdated is used when the state of a participant changed (e.g.: active, alerting)
+	ParticipantUpdated RosterChange = "updated"
+)
+
+// RosterChangedEvent is sent when a participant joined, left, or changed state in the chat
+//
+// The roster of the chat is available with Chat.Agents and Chat.ActiveParticipants.
+type RosterChangedEvent struct {
+	ChatID      string       `json:"chatID"`
+	Participant Participant  `json:"participant"`
+	Change      RosterChange `json:"change"`
+}
+
+// GetType returns the type of this event
+func (event RosterChangedEvent) GetType() string {
+	return "rosterChanged"
+}
+
+func (event RosterChangedEvent) String() string {
+	return fmt.Sprintf("Participant %s (%s) %s", event.Participant.Name, event.Participant.ID, event.Change)
+}
+
+// MarshalJSON encodes into JSON
+func (event RosterChangedEvent) MarshalJSON() ([]byte, error) {
+	type surrogate RosterChangedEvent
+	payload, err := json.Marshal(struct {
+		surrogate
+		Type string `json:"type"`
+	}{
+		surrogate(event),
+		event.GetType(),
+	})
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
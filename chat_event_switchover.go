@@ -0,0 +1,38 @@
+package iwt
+
+import (
+	"encoding/json"
+
+	"github.com/gildas/go-errors"
+)
+
+// SwitchoverEvent is sent when the Client switched to another API endpoint
+//
+// After this event, the chat reconnects to the new API endpoint (To).
+type SwitchoverEvent struct {
+	ChatID string `json:"chatID"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// GetType returns the type of this event
+func (event SwitchoverEvent) GetType() string {
+	return "switchover"
+}
+
+func (event SwitchoverEvent) String() string {
+	return "switchover from " + event.From + " to " + event.To
+}
+
+// MarshalJSON encodes into JSON
+func (event SwitchoverEvent) MarshalJSON() ([]byte, error) {
+	type surrogate SwitchoverEvent
+	payload, err := json.Marshal(struct {
+		surrogate
+		Type string `json:"type"`
+	}{
+		surrogate(event),
+		event.GetType(),
+	})
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
@@ -49,11 +49,11 @@ func (suite *ChatEventSuite) SetupSuite() {
 	primaryAPI, err := url.Parse(core.GetEnvAsString("PRIMARY", ""))
 	suite.Require().Nil(err, "Failed to parse Primary PureConnect URL")
 
-	suite.Client = iwt.NewClient(context.Background(), iwt.ClientOptions{
+	suite.Client, err = iwt.NewClient(context.Background(), iwt.ClientOptions{
 		PrimaryAPI: primaryAPI,
 		Logger:     suite.Logger,
 	})
-	suite.Require().NotNil(suite.Client, "Failed to instantiate a new IWT Client")
+	suite.Require().Nil(err, "Failed to instantiate a new IWT Client, Error: %s", err)
 
 	suite.Logger.Infof("Suite Start %s %s", suite.Name, strings.Repeat("=", 80-14-len(suite.Name)))
 }
@@ -0,0 +1,186 @@
+package iwt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gildas/go-errors"
+)
+
+// DefaultMaxFileSize is the maximum size of the files the web user can send, if not given in the ClientOptions
+const DefaultMaxFileSize = int64(10 * 1024 * 1024)
+
+// DefaultAllowedFileTypes are the content types of the files the web user can send, if not given in the ClientOptions
+var DefaultAllowedFileTypes = []string{"image/*", "application/pdf"}
+
+// FileStore stores the files of the web user when PureConnect cannot receive them
+//
+// The returned URL is sent to the agent instead of the file, it must be reachable by the agent.
+type FileStore interface {
+	Store(ctx context.Context, name, contentType string, reader io.Reader) (*url.URL, error)
+}
+
+// FileStoreFunc is a function that can be used as a FileStore
+type FileStoreFunc func(ctx context.Context, name, contentType string, reader io.Reader) (*url.URL, error)
+
+// Store stores the file by calling the function
+func (f FileStoreFunc) Store(ctx context.Context, name, contentType string, reader io.Reader) (*url.URL, error) {
+	return f(ctx, name, contentType, reader)
+}
+
+// UploadProgressFunc is called while a file is sent, with how many bytes of the file were sent so far out of total
+type UploadProgressFunc func(name string, sent, total int64)
+
+// SendFile sends a file from the web user to the chat
+//
+// If the PureConnect server advertises the sendFile capability, the file is uploaded to the chat.
+// Otherwise, if the Client has a FileStore, the file is stored there and its URL is sent instead.
+//
+// If contentType is empty, it is guessed from the name of the file or its content.
+// The file must not be larger than the MaxFileSize of the Client, and its content type must be allowed by its AllowedFileTypes.
+func (chat *Chat) SendFile(ctx context.Context, name, contentType string, reader io.Reader) error {
+	log := chat.Logger.Scope("sendfile")
+	chatID, webUser, ok := chat.webUser()
+	if !ok {
+		log.Errorf("chat is not connected")
+		return StatusNotConnectedEntity
+	}
+	if len(name) == 0 {
+		return errors.ArgumentMissing.With("name")
+	}
+	if reader == nil {
+		return errors.ArgumentMissing.With("reader")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, chat.Client.MaxFileSize+1))
+	if err != nil {
+		log.Errorf("Failed to read file %s", name, err)
+		return errors.WithStack(err)
+	}
+	if len(contentType) == 0 {
+		contentType = guessFileType(name, data)
+	}
+	if err := chat.validateFile(name, contentType, data); err != nil {
+		log.Errorf("Cannot send file %s", name, err)
+		return err
+	}
+
+	if !chat.Client.supportsCapability(ctx, "chat", "sendFile") {
+		return chat.storeFile(ctx, name, contentType, data)
+	}
+
+	log.Debugf("Uploading %s file %s (%d bytes)...", contentType, name, len(data))
+	results := struct {
+		Chat chatResponse `json:"chat"`
+	}{}
+	_, err = chat.post(ctx, "/chat/sendFile/"+webUser.ID,
+		multipartPayload{
+			Fields:      map[string]string{">file": name},
+			ContentType: contentType,
+			Open:        func() io.Reader { return chat.progressReader(name, data) },
+		},
+		&results)
+	if err != nil {
+		log.Errorf("Failed to send /chat/sendFile request", err)
+		return err
+	}
+	chat.deferEvents(results.Chat.Events)
+	return results.Chat.Status.Param("id", chatID).AsError()
+}
+
+// storeFile stores the file in the FileStore of the Client and sends its URL to the chat
+func (chat *Chat) storeFile(ctx context.Context, name, contentType string, data []byte) error {
+	log := chat.Logger.Scope("sendfile")
+	if chat.Client.FileStore == nil {
+		log.Errorf("The server cannot receive files and there is no FileStore")
+		return StatusUnsupportedRequest.Param("capability", "sendFile")
+	}
+
+	log.Debugf("Storing %s file %s (%d bytes)...", contentType, name, len(data))
+	link, err := chat.Client.FileStore.Store(ctx, name, contentType, chat.progressReader(name, data))
+	if err != nil {
+		log.Errorf("Failed to store file %s", name, err)
+		return err
+	}
+	if chat.SupportsContentType(URLContentType) {
+		return chat.SendURL(ctx, link)
+	}
+	return chat.SendText(ctx, link.String())
+}
+
+// validateFile checks a file against the size and content types the client allows
+func (chat *Chat) validateFile(name, contentType string, data []byte) error {
+	if len(data) == 0 {
+		return StatusContentMissing.Param("name", name)
+	}
+	if size := int64(len(data)); size > chat.Client.MaxFileSize {
+		return StatusContentTooLong.Param("name", name).Param("max", chat.Client.MaxFileSize)
+	}
+	if !matchesFileType(chat.Client.AllowedFileTypes, contentType) {
+		return StatusInvalidContentType.Param("name", name).Param("contentType", contentType)
+	}
+	return nil
+}
+
+// progressReader gives a reader over the data of a file that reports the progress of the upload
+func (chat *Chat) progressReader(name string, data []byte) io.Reader {
+	chat.mutex.RLock()
+	progress := chat.uploadProgress
+	chat.mutex.RUnlock()
+	if progress == nil {
+		return bytes.NewReader(data)
+	}
+	return &uploadProgressReader{reader: bytes.NewReader(data), name: name, total: int64(len(data)), progress: progress}
+}
+
+// uploadProgressReader calls an UploadProgressFunc as the file is read
+type uploadProgressReader struct {
+	reader   io.Reader
+	name     string
+	sent     int64
+	total    int64
+	progress UploadProgressFunc
+}
+
+func (reader *uploadProgressReader) Read(buffer []byte) (int, error) {
+	count, err := reader.reader.Read(buffer)
+	if count > 0 {
+		reader.sent += int64(count)
+		reader.progress(reader.name, reader.sent, reader.total)
+	}
+	return count, err
+}
+
+// guessFileType guesses the content type of a file from its name, or from its content
+func guessFileType(name string, data []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); len(contentType) > 0 {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			return mediaType
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+// matchesFileType tells if the content type matches one of the allowed types (e.g.: image/png matches image/*)
+func matchesFileType(allowed []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range allowed {
+		if pattern == "*/*" || strings.EqualFold(pattern, mediaType) {
+			return true
+		}
+		if prefix, found := strings.CutSuffix(pattern, "/*"); found && strings.HasPrefix(mediaType, strings.ToLower(prefix)+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package iwt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanSendFile(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.Capabilities["chat"] = append(server.Capabilities["chat"], "sendFile")
+
+	var sent, total int64
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{OnUploadProgress: func(name string, s, t int64) {
+		sent, total = s, t
+	}})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	err := chat.SendFile(context.Background(), "receipt.pdf", "", bytes.NewReader(data))
+	require.Nil(t, err, "Failed to send file, Error: %s", err)
+
+	uploads := serverChat.Uploads()
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "receipt.pdf", uploads[0].Name)
+	assert.Equal(t, "application/pdf", uploads[0].ContentType)
+	assert.Equal(t, data, uploads[0].Data)
+	assert.Equal(t, int64(len(data)), sent)
+	assert.Equal(t, int64(len(data)), total)
+	assert.Empty(t, serverChat.Messages(), "The file should not be sent as a message")
+}
+
+func TestShouldSendFileAgainWhenRejected(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &iwt.RetryPolicy{InitialDelay: 10 * time.Millisecond}})
+	server.Capabilities["chat"] = append(server.Capabilities["chat"], "sendFile")
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	server.FailHTTP("/chat/sendFile", http.StatusServiceUnavailable, 1)
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	err := chat.SendFile(context.Background(), "receipt.pdf", "", bytes.NewReader(data))
+	require.Nil(t, err, "Failed to send file, Error: %s", err)
+
+	assert.Len(t, server.RequestsTo("/chat/sendFile"), 2, "The rejected upload should have been sent again")
+	uploads := serverChat.Uploads()
+	require.Len(t, uploads, 1)
+	assert.Equal(t, data, uploads[0].Data, "The file should be sent whole again")
+}
+
+func TestShouldValidateFiles(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{MaxFileSize: 16})
+	server.Capabilities["chat"] = append(server.Capabilities["chat"], "sendFile")
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	err := chat.SendFile(context.Background(), "big.png", "image/png", strings.NewReader("this file is way too big"))
+	assert.ErrorIs(t, err, iwt.StatusContentTooLong)
+	err = chat.SendFile(context.Background(), "virus.exe", "application/octet-stream", strings.NewReader("MZ"))
+	assert.ErrorIs(t, err, iwt.StatusInvalidContentType)
+	err = chat.SendFile(context.Background(), "empty.png", "image/png", strings.NewReader(""))
+	assert.ErrorIs(t, err, iwt.StatusContentMissing)
+	assert.Empty(t, serverChat.Uploads(), "Invalid files should not be sent")
+}
+
+func TestCanSendFileToStore(t *testing.T) {
+	stored := map[string][]byte{}
+	mutex := sync.Mutex{}
+	store := iwt.FileStoreFunc(func(ctx context.Context, name, contentType string, reader io.Reader) (*url.URL, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		mutex.Lock()
+		stored[name] = data
+		mutex.Unlock()
+		return url.Parse("https://files.acme.com/" + name)
+	})
+	server, client := newTestFixture(t, iwt.ClientOptions{FileStore: store})
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/uri-list"}
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{})
+	err := chat.SendFile(context.Background(), "photo.png", "image/png", strings.NewReader("not really a png"))
+	require.Nil(t, err, "Failed to send file, Error: %s", err)
+
+	assert.Equal(t, []byte("not really a png"), stored["photo.png"])
+	assert.Empty(t, serverChat.Uploads(), "The server does not support uploads")
+	messages := serverChat.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "https://files.acme.com/photo.png", messages[0].Text)
+	assert.Equal(t, "text/uri-list", messages[0].ContentType)
+}
+
+func TestFailsSendFileWithoutUploadOrStore(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	chat, _ := startTestChat(t, server, client, iwt.StartChatOptions{})
+	err := chat.SendFile(context.Background(), "photo.png", "image/png", strings.NewReader("not really a png"))
+	assert.ErrorIs(t, err, iwt.StatusUnsupportedRequest)
+}
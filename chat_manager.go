@@ -0,0 +1,224 @@
+package iwt
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+// DefaultShutdownTimeout is how long ChatManager.Shutdown waits for the chats to stop, if the context has no deadline
+const DefaultShutdownTimeout = 30 * time.Second
+
+// TooManyChatsError is returned when a ChatManager already manages its maximum number of chats
+var TooManyChatsError = errors.NewSentinel(http.StatusTooManyRequests, "error.iwt.chat.toomany", "Too many chats, the maximum is %s")
+
+// ChatManagerShutdownError is returned when a chat is started or resumed by a ChatManager that is shutting down
+var ChatManagerShutdownError = errors.NewSentinel(http.StatusServiceUnavailable, "error.iwt.chat.shutdown", "The chat manager is shutting down")
+
+// ChatManager starts and tracks the live chats of a Client
+//
+// Chats are indexed by their ID and by the ID of their Guest (their id on LINE, KKT, etc).
+// They are forgotten when they stop.
+// The ChatManager methods are safe to call from several goroutines.
+type ChatManager struct {
+	Client   *Client
+	MaxChats int // 0 means no limit
+	Logger   *logger.Logger
+	chats    map[string]*Chat // indexed by chat ID
+	guests   map[string]*Chat // indexed by Guest ID
+	starting int              // chats being started, they count in MaxChats
+	closing  bool
+	mutex    sync.RWMutex
+}
+
+// NewChatManager instantiates a new ChatManager that manages at most maxChats chats (0 means no limit)
+func NewChatManager(client *Client, maxChats int) *ChatManager {
+	return &ChatManager{
+		Client:   client,
+		MaxChats: maxChats,
+		Logger:   client.Logger.Child("manager", "manager"),
+		chats:    map[string]*Chat{},
+		guests:   map[string]*Chat{},
+	}
+}
+
+// StartChat starts a chat and registers it
+//
+// If the manager already manages MaxChats chats, an error matching TooManyChatsError is returned.
+func (manager *ChatManager) StartChat(ctx context.Context, options StartChatOptions) (*Chat, error) {
+	if err := manager.reserve(); err != nil {
+		return nil, err
+	}
+	chat, err := manager.Client.StartChat(ctx, options)
+	return manager.register(chat, err)
+}
+
+// ResumeChat resumes a chat from its JSON state and registers it
+//
+// If the manager already manages MaxChats chats, an error matching TooManyChatsError is returned.
+func (manager *ChatManager) ResumeChat(ctx context.Context, state []byte, options ResumeChatOptions) (*Chat, error) {
+	if err := manager.reserve(); err != nil {
+		return nil, err
+	}
+	chat, err := manager.Client.ResumeChat(ctx, state, options)
+	return manager.register(chat, err)
+}
+
+// Get gives the chat with the given ID
+func (manager *ChatManager) Get(chatID string) (*Chat, bool) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	chat, found := manager.chats[chatID]
+	return chat, found
+}
+
+// GetByGuest gives the chat of the Guest with the given ID
+func (manager *ChatManager) GetByGuest(guestID string) (*Chat, bool) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	chat, found := manager.guests[guestID]
+	return chat, found
+}
+
+// List gives the live chats
+func (manager *ChatManager) List() []*Chat {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	chats := make([]*Chat, 0, len(manager.chats))
+	for _, chat := range manager.chats {
+		chats = append(chats, chat)
+	}
+	return chats
+}
+
+// Count tells how many chats are live
+func (manager *ChatManager) Count() int {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	return len(manager.chats)
+}
+
+// StopAll stops all the live chats, concurrently
+//
+// It returns when all the chats are stopped or when the context is done.
+// The errors of the chats that could not be stopped are returned together.
+func (manager *ChatManager) StopAll(ctx context.Context) error {
+	chats := manager.List()
+	manager.Logger.Infof("Stopping %d chats", len(chats))
+
+	results := make(chan error, len(chats))
+	for _, chat := range chats {
+		go func(chat *Chat) {
+			results <- chat.Stop(ctx)
+		}(chat)
+	}
+	errs := &errors.MultiError{}
+	for range chats {
+		select {
+		case err := <-results:
+			errs.Append(err)
+		case <-ctx.Done():
+			errs.Append(errors.WithStack(ctx.Err()))
+			return errs.AsError()
+		}
+	}
+	return errs.AsError()
+}
+
+// Shutdown stops all the live chats and refuses new ones
+//
+// If the context has no deadline, Shutdown waits at most DefaultShutdownTimeout.
+// The chats that could not be stopped (e.g.: PureConnect was not reachable) are terminated anyway,
+// so no chat is left polling when Shutdown returns.
+func (manager *ChatManager) Shutdown(ctx context.Context) error {
+	manager.mutex.Lock()
+	manager.closing = true
+	manager.mutex.Unlock()
+
+	if _, found := ctx.Deadline(); !found {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultShutdownTimeout)
+		defer cancel()
+	}
+	err := manager.StopAll(ctx)
+
+	manager.mutex.Lock()
+	chats := manager.chats
+	manager.chats = map[string]*Chat{}
+	manager.guests = map[string]*Chat{}
+	manager.mutex.Unlock()
+	for _, chat := range chats {
+		if chat.IsConnected() {
+			manager.Logger.Warnf("Chat %s could not be stopped, terminating it", chat)
+		}
+		_ = chat.terminate()
+	}
+	return err
+}
+
+// reserve books a place for a new chat, if the limit allows it
+func (manager *ChatManager) reserve() error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if manager.closing {
+		return errors.WithStack(ChatManagerShutdownError)
+	}
+	if manager.MaxChats > 0 && len(manager.chats)+manager.starting >= manager.MaxChats {
+		manager.Logger.Warnf("Cannot start a new chat, already %d chats (max: %d)", len(manager.chats)+manager.starting, manager.MaxChats)
+		return TooManyChatsError.With(strconv.Itoa(manager.MaxChats))
+	}
+	manager.starting++
+	return nil
+}
+
+// register registers a chat that was started or resumed, and releases its reserved place
+//
+// The chat is unregistered when it stops.
+func (manager *ChatManager) register(chat *Chat, err error) (*Chat, error) {
+	var chatID, guestID string
+	if err == nil {
+		chat.mutex.RLock()
+		chatID, guestID = chat.ID, chat.Guest.ID
+		chat.mutex.RUnlock()
+	}
+
+	manager.mutex.Lock()
+	manager.starting--
+	if err != nil {
+		manager.mutex.Unlock()
+		return nil, err
+	}
+	if manager.closing {
+		manager.mutex.Unlock()
+		_ = chat.Stop(context.Background())
+		return nil, errors.WithStack(ChatManagerShutdownError)
+	}
+	manager.chats[chatID] = chat
+	if len(guestID) > 0 {
+		manager.guests[guestID] = chat
+	}
+	manager.mutex.Unlock()
+
+	go func() {
+		<-chat.Done()
+		manager.unregister(chatID, guestID, chat)
+	}()
+	return chat, nil
+}
+
+// unregister forgets a chat that stopped
+func (manager *ChatManager) unregister(chatID, guestID string, chat *Chat) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if manager.chats[chatID] == chat {
+		delete(manager.chats, chatID)
+	}
+	if manager.guests[guestID] == chat {
+		delete(manager.guests, guestID)
+	}
+}
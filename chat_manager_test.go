@@ -0,0 +1,103 @@
+package iwt_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startManagedChat(manager *iwt.ChatManager, guestID string) (*iwt.Chat, error) {
+	return manager.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{ID: guestID, Name: "Guest " + guestID},
+	})
+}
+
+func TestCanManageChats(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	manager := iwt.NewChatManager(client, 2)
+
+	first, err := startManagedChat(manager, "U001")
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	second, err := startManagedChat(manager, "U002")
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	assert.Equal(t, 2, manager.Count())
+	assert.ElementsMatch(t, []*iwt.Chat{first, second}, manager.List())
+
+	chat, found := manager.Get(first.ID)
+	assert.True(t, found)
+	assert.Same(t, first, chat)
+	chat, found = manager.GetByGuest("U002")
+	assert.True(t, found)
+	assert.Same(t, second, chat)
+	_, found = manager.GetByGuest("U003")
+	assert.False(t, found)
+
+	_, err = startManagedChat(manager, "U003")
+	assert.ErrorIs(t, err, iwt.TooManyChatsError)
+	assert.Len(t, server.Chats(), 2, "The third chat should not reach the server")
+
+	firstID := first.ID
+	require.Nil(t, first.Stop(context.Background()))
+	assert.Eventually(t, func() bool { return manager.Count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	_, found = manager.Get(firstID)
+	assert.False(t, found, "Stopped chats should be forgotten")
+	_, found = manager.GetByGuest("U001")
+	assert.False(t, found, "Stopped chats should be forgotten")
+
+	third, err := startManagedChat(manager, "U003")
+	require.Nil(t, err, "Failed to start a chat after one stopped, Error: %s", err)
+	assert.NotNil(t, third)
+}
+
+func TestCanShutdownChatManager(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	manager := iwt.NewChatManager(client, 0)
+
+	// More chats than the fake server used to buffer before WaitForChat is called
+	for index := 1; index <= 80; index++ {
+		_, err := startManagedChat(manager, fmt.Sprintf("U%03d", index))
+		require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	}
+	first := server.WaitForChat(time.Second)
+	require.NotNil(t, first, "The first chat should still be waiting")
+	assert.Equal(t, "Guest U001", first.GuestName)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := manager.Shutdown(ctx)
+	require.Nil(t, err, "Failed to shutdown, Error: %s", err)
+	for _, chat := range server.Chats() {
+		assert.True(t, chat.IsExited(), "Chat %s should be stopped", chat.ID)
+	}
+	assert.Eventually(t, func() bool { return manager.Count() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = startManagedChat(manager, "U081")
+	assert.ErrorIs(t, err, iwt.ChatManagerShutdownError)
+}
+
+func TestShouldTerminateChatsThatFailToStopOnShutdown(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &iwt.NoRetry})
+	manager := iwt.NewChatManager(client, 0)
+
+	chat, err := startManagedChat(manager, "U001")
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	server.FailHTTP("/chat/exit/", http.StatusInternalServerError, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = manager.Shutdown(ctx)
+	assert.NotNil(t, err, "Shutdown should tell the chat could not be stopped")
+	assert.Equal(t, 0, manager.Count(), "The chat should be forgotten")
+	assert.False(t, chat.IsConnected(), "The chat should be terminated")
+	select {
+	case <-chat.Done():
+	default:
+		assert.Fail(t, "The chat should be done")
+	}
+}
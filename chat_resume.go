@@ -0,0 +1,85 @@
+package iwt
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// ResumeChatOptions defines the options when resuming a chat
+//
+// They are the same as the delivery options of StartChatOptions, which are not stored with the chat.
+type ResumeChatOptions struct {
+	TypingDebounce    time.Duration       // how often SetTyping(true) is sent to PureConnect, default: DefaultTypingDebounce
+	TypingIdleTimeout time.Duration       // when the web user is considered as having stopped typing, default: DefaultTypingIdleTimeout
+	EventBufferSize   int                 // size of Chat.EventChan, default: DefaultEventBufferSize
+	OverflowPolicy    EventOverflowPolicy // what to do when Chat.EventChan is full, default: BlockOnOverflow
+	Handlers          ChatHandlers        // if given, the chat calls these instead of letting the caller read Chat.EventChan
+	OnUploadProgress  UploadProgressFunc  // if given, called while Chat.SendFile sends a file
+}
+
+// ResumeChat rebuilds a live chat from its JSON state (as given by json.Marshal(chat)), after a process restart e.g.
+//
+// The chat is reconnected to the current API endpoint, which validates it.
+// Events that were already delivered before the state was stored are not delivered again.
+// If PureConnect does not know the chat anymore, an error matching StatusUnknownEntitySession is returned.
+func (client *Client) ResumeChat(ctx context.Context, state []byte, options ResumeChatOptions) (*Chat, error) {
+	log := client.Logger.Child("chat", "resume")
+
+	chat := &Chat{}
+	if err := json.Unmarshal(state, chat); err != nil {
+		log.Errorf("Failed to unmarshal the chat state", err)
+		return nil, errors.JSONUnmarshalError.Wrap(err)
+	}
+	if len(chat.ID) == 0 || len(chat.Participants) == 0 || len(chat.Participants[0].ID) == 0 {
+		log.Errorf("The chat state has no chat ID or no web user")
+		return nil, errors.ArgumentMissing.With("chatID")
+	}
+	if chat.PollWaitSuggestion < time.Second {
+		chat.PollWaitSuggestion = time.Second
+	}
+	chat.bind(client, options)
+
+	log.Debugf("Resuming chat %s from sequence numbers %v", chat.ID, chat.NextSequenceNumbers)
+	if !chat.handlers.IsEmpty() {
+		go chat.dispatchEvents()
+	}
+	if err := chat.Reconnect(ctx); err != nil {
+		log.Errorf("Failed to resume chat %s", chat.ID, err)
+		chat.Client.unregisterChat(chat)
+		chat.stopPollingMessages()
+		chat.cancel()
+		return nil, err
+	}
+	chat.Logger.Infof("Chat resumed on queue %s with %s (%s)", chat.Queue, chat.Participants[0].Name, chat.Participants[0].ID)
+	return chat, nil
+}
+
+// MarshalJSON encodes the chat state into JSON
+//
+// The state can be given to Client.ResumeChat to resume the chat later.
+func (chat *Chat) MarshalJSON() ([]byte, error) {
+	type surrogate Chat
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	payload, err := json.Marshal((*surrogate)(chat))
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
+
+// bind attaches the chat to the client and prepares its event delivery
+func (chat *Chat) bind(client *Client, options ResumeChatOptions) {
+	if options.EventBufferSize <= 0 {
+		options.EventBufferSize = DefaultEventBufferSize
+	}
+	chat.EventChan = make(chan ChatEvent, options.EventBufferSize)
+	chat.Client = client
+	chat.Logger = client.Logger.Child("chat", "chat", "chat", chat.ID)
+	chat.typing = newTypingIndicator(options.TypingDebounce, options.TypingIdleTimeout)
+	chat.overflowPolicy = options.OverflowPolicy
+	chat.handlers = options.Handlers
+	chat.uploadProgress = options.OnUploadProgress
+	chat.context, chat.cancel = context.WithCancel(client.Context)
+	client.registerChat(chat)
+}
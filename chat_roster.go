@@ -0,0 +1,110 @@
+package iwt
+
+import "time"
+
+// Agents gives the agents that are currently connected to the chat
+func (chat *Chat) Agents() []Participant {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	agents := []Participant{}
+	for _, participant := range chat.Participants {
+		if participant.Type == "Agent" && participant.State != "disconnected" {
+			agents = append(agents, participant)
+		}
+	}
+	return agents
+}
+
+// ActiveParticipants gives the participants of the chat that are active, including the web user
+func (chat *Chat) ActiveParticipants() []Participant {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	participants := []Participant{}
+	for _, participant := range chat.Participants {
+		if participant.State == "active" {
+			participants = append(participants, participant)
+		}
+	}
+	return participants
+}
+
+// updateRoster updates Chat.Participants from a participantStateChanged event
+//
+// returns the RosterChangedEvent to deliver, or nil if nothing changed.
+func (chat *Chat) updateRoster(event *ParticipantStateChangedEvent) *RosterChangedEvent {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+
+	incoming := event.Participant
+	for index := range chat.Participants {
+		participant := &chat.Participants[index]
+		if participant.ID != incoming.ID {
+			continue
+		}
+		previous := participant.State
+		if previous == incoming.State {
+			return nil
+		}
+		participant.State = incoming.State
+		if len(incoming.Name) > 0 {
+			participant.Name = incoming.Name
+		}
+		change := ParticipantUpdated
+		if incoming.State == "disconnected" {
+			change = ParticipantLeft
+		} else if len(previous) == 0 || previous == "disconnected" {
+			change = ParticipantJoined
+		}
+		return &RosterChangedEvent{ChatID: chat.ID, Participant: *participant, Change: change}
+	}
+
+	if incoming.State == "disconnected" {
+		// we never saw this participant, there is nothing to remove
+		return nil
+	}
+	chat.Participants = append(chat.Participants, incoming)
+	if incoming.ID != SystemParticipant.ID {
+		go chat.enrichParticipant(incoming.ID)
+	}
+	return &RosterChangedEvent{ChatID: chat.ID, Participant: incoming, Change: ParticipantJoined}
+}
+
+// observeAgentWait gives the time the chat waited for its first agent to the Metrics of the Client
+func (chat *Chat) observeAgentWait(change *RosterChangedEvent) {
+	if change.Change != ParticipantJoined || change.Participant.Type != "Agent" {
+		return
+	}
+	chat.mutex.Lock()
+	first := !chat.agentJoined && !chat.startedAt.IsZero()
+	chat.agentJoined = true
+	startedAt := chat.startedAt
+	chat.mutex.Unlock()
+	if first {
+		chat.Client.Metrics.ObserveAgentWait(time.Since(startedAt))
+	}
+}
+
+// enrichParticipant fetches the name and picture of a participant who joined the chat
+func (chat *Chat) enrichParticipant(id string) {
+	log := chat.Logger.Scope("roster")
+
+	info, err := chat.GetParticipant(chat.context, id)
+	if err != nil {
+		log.Debugf("Failed to fetch the information of participant %s: %s", id, err)
+		return
+	}
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	for index := range chat.Participants {
+		participant := &chat.Participants[index]
+		if participant.ID == id {
+			if len(info.Name) > 0 {
+				participant.Name = info.Name
+			}
+			if info.Picture != nil {
+				participant.Picture = info.Picture
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package iwt
+
+import (
+	"sort"
+)
+
+// gapTolerance is how many batches of events a gap can survive before it is reported with a GapDetectedEvent
+//
+// PureConnect can give an event in a later poll than the events that follow it,
+// so the missing events are often in the next batch.
+const gapTolerance = 2
+
+// sequence locates an event in the chat: its conversation (ConversationSequenceNumber) and its sequence number in that conversation
+type sequence struct {
+	conversation int
+	number       int
+}
+
+// sequencedEvent is an event of a batch with its sequence, if it has one
+type sequencedEvent struct {
+	event     ChatEvent
+	sequence  sequence
+	sequenced bool
+}
+
+// sequenceEvents gives the events of a batch that can be delivered, in sequence order
+//
+// The sequence numbers are tracked per conversation, as given by the ConversationSequenceNumber of the messages.
+// Events that were already delivered (e.g.: replayed by /chat/reconnect) are dropped,
+// events received after a gap are held back until the gap is filled or reported with a GapDetectedEvent.
+// Events without a sequence number are delivered first, as they come.
+//
+// The caller must hold chat.sequenceMutex.
+func (chat *Chat) sequenceEvents(events []chatEventWrapper) []ChatEvent {
+	log := chat.Logger.Scope("sequence")
+
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if chat.pendingEvents == nil {
+		chat.pendingEvents = map[sequence]ChatEvent{}
+	}
+	if chat.NextSequenceNumbers == nil {
+		chat.NextSequenceNumbers = map[int]int{}
+	}
+
+	// The first events of a conversation that was not seen yet start its sequence
+	batch := make([]sequencedEvent, 0, len(events))
+	starts := map[int]int{}
+	for _, wrapper := range events {
+		key, ok := chat.sequenceOf(wrapper.Event)
+		batch = append(batch, sequencedEvent{event: wrapper.Event, sequence: key, sequenced: ok})
+		if _, known := chat.NextSequenceNumbers[key.conversation]; ok && !known {
+			if start, found := starts[key.conversation]; !found || key.number < start {
+				starts[key.conversation] = key.number
+			}
+		}
+	}
+	for conversation, start := range starts {
+		log.Debugf("Conversation %d starts at event #%d", conversation, start)
+		chat.NextSequenceNumbers[conversation] = start
+	}
+
+	ordered := make([]ChatEvent, 0, len(events))
+	for _, item := range batch {
+		if !item.sequenced {
+			ordered = append(ordered, item.event)
+			continue
+		}
+		if _, found := chat.pendingEvents[item.sequence]; found || item.sequence.number < chat.NextSequenceNumbers[item.sequence.conversation] {
+			log.Debugf("Event %s #%d of conversation %d was already received, ignoring it", item.event.GetType(), item.sequence.number, item.sequence.conversation)
+			continue
+		}
+		chat.pendingEvents[item.sequence] = item.event
+	}
+	conversations := chat.pendingConversations()
+	for _, conversation := range conversations {
+		ordered = append(ordered, chat.nextPendingEvents(conversation)...)
+	}
+
+	if len(chat.pendingEvents) == 0 {
+		chat.gapAge = 0
+		return ordered
+	}
+	if chat.gapAge++; chat.gapAge <= gapTolerance {
+		log.Debugf("Waiting for missing events, %d events are held back", len(chat.pendingEvents))
+		return ordered
+	}
+	for _, conversation := range chat.pendingConversations() {
+		from := chat.NextSequenceNumbers[conversation]
+		to := from
+		for {
+			if _, found := chat.pendingEvents[sequence{conversation, to + 1}]; found {
+				break
+			}
+			to++
+		}
+		log.Warnf("Events #%d to #%d of conversation %d are missing", from, to, conversation)
+		ordered = append(ordered, GapDetectedEvent{ChatID: chat.ID, Conversation: conversation, From: from, To: to})
+		chat.NextSequenceNumbers[conversation] = to + 1
+		ordered = append(ordered, chat.nextPendingEvents(conversation)...)
+	}
+	chat.gapAge = 0
+	return ordered
+}
+
+// sequenceOf gives the sequence of an event received from PureConnect
+//
+// Only the messages carry a ConversationSequenceNumber, the other events belong to the conversation of the last message.
+//
+// The caller must hold chat.mutex.
+func (chat *Chat) sequenceOf(event ChatEvent) (sequence, bool) {
+	switch evt := event.(type) {
+	case *TextEvent:
+		chat.Conversation = evt.ConversationSequenceNumber
+		return sequence{evt.ConversationSequenceNumber, evt.SequenceNumber}, true
+	case *FileEvent:
+		chat.Conversation = evt.ConversationSequenceNumber
+		return sequence{evt.ConversationSequenceNumber, evt.SequenceNumber}, true
+	case *URLEvent:
+		return sequence{chat.Conversation, evt.SequenceNumber}, true
+	case *TypingIndicatorEvent:
+		return sequence{chat.Conversation, evt.SequenceNumber}, true
+	case *ParticipantStateChangedEvent:
+		return sequence{chat.Conversation, evt.SequenceNumber}, true
+	}
+	return sequence{}, false
+}
+
+// pendingConversations gives the conversations that have events held back, in order
+//
+// The caller must hold chat.mutex.
+func (chat *Chat) pendingConversations() []int {
+	conversations := []int{}
+	seen := map[int]bool{}
+	for key := range chat.pendingEvents {
+		if !seen[key.conversation] {
+			seen[key.conversation] = true
+			conversations = append(conversations, key.conversation)
+		}
+	}
+	sort.Ints(conversations)
+	return conversations
+}
+
+// nextPendingEvents removes from the pending events of the conversation the ones that follow its last delivered event, in order
+//
+// The caller must hold chat.mutex.
+func (chat *Chat) nextPendingEvents(conversation int) []ChatEvent {
+	events := []ChatEvent{}
+	for {
+		key := sequence{conversation, chat.NextSequenceNumbers[conversation]}
+		event, found := chat.pendingEvents[key]
+		if !found {
+			return events
+		}
+		delete(chat.pendingEvents, key)
+		events = append(events, event)
+		chat.NextSequenceNumbers[conversation]++
+	}
+}
+
+// deferEvents keeps the events of a response other than /chat/poll for the next poll
+//
+// So the poller processes all the batches, one at a time and in the order they were received.
+func (chat *Chat) deferEvents(events []chatEventWrapper) {
+	if len(events) == 0 {
+		return
+	}
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	chat.deferredEvents = append(chat.deferredEvents, events...)
+}
+
+// takeDeferredEvents gives the events kept by deferEvents and forgets them
+func (chat *Chat) takeDeferredEvents() []chatEventWrapper {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	events := chat.deferredEvents
+	chat.deferredEvents = nil
+	return events
+}
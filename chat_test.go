@@ -0,0 +1,770 @@
+package iwt_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChatSuite struct {
+	suite.Suite
+	Name   string
+	Start  time.Time
+	Server *iwttest.Server
+	Client *iwt.Client
+	Logger *logger.Logger
+}
+
+func TestChatSuite(t *testing.T) {
+	suite.Run(t, new(ChatSuite))
+}
+
+// *****************************************************************************
+// Suite Tools
+
+func (suite *ChatSuite) SetupSuite() {
+	suite.Name = strings.TrimSuffix(reflect.TypeOf(suite).Elem().Name(), "Suite")
+	suite.Logger = logger.Create("test",
+		&logger.FileStream{
+			Path:         fmt.Sprintf("./log/test-%s.log", strings.ToLower(suite.Name)),
+			Unbuffered:   true,
+			SourceInfo:   true,
+			FilterLevels: logger.NewLevelSet(logger.TRACE),
+		},
+	).Child("test", "test")
+
+	suite.Server = iwttest.NewServer()
+	suite.Server.AddQueue("Sales", "Workgroup", 2, 30)
+
+	var err error
+	suite.Client, err = iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI: suite.Server.APIURL(),
+		Logger:     suite.Logger,
+	})
+	suite.Require().Nil(err, "Failed to instantiate a new IWT Client, Error: %s", err)
+
+	suite.Logger.Infof("Suite Start %s %s", suite.Name, strings.Repeat("=", 80-14-len(suite.Name)))
+}
+
+func (suite *ChatSuite) TearDownSuite() {
+	suite.Server.Close()
+	suite.Logger.Infof("Suite End %s %s", suite.Name, strings.Repeat("=", 80-12-len(suite.Name)))
+	suite.Logger.Close()
+}
+
+func (suite *ChatSuite) BeforeTest(suiteName, testName string) {
+	suite.Logger.Infof("Test Start %s %s", testName, strings.Repeat("-", 80-13-len(testName)))
+	suite.Start = time.Now()
+}
+
+func (suite *ChatSuite) AfterTest(suiteName, testName string) {
+	duration := time.Since(suite.Start)
+	suite.Logger.Record("duration", duration.String()).Infof("Test End %s %s", testName, strings.Repeat("-", 80-11-len(testName)))
+}
+
+// StartChat starts a chat on the Sales queue and gives the chat as seen by the fake server
+func (suite *ChatSuite) StartChat() (*iwt.Chat, *iwttest.Chat) {
+	return startTestChat(suite.T(), suite.Server, suite.Client, iwt.StartChatOptions{})
+}
+
+// StopChat stops the chat while consuming its events
+func (suite *ChatSuite) StopChat(chat *iwt.Chat) {
+	done := make(chan error)
+	go func() { done <- chat.Stop(context.Background()) }()
+	for {
+		select {
+		case err := <-done:
+			suite.Require().Nil(err, "Failed to stop a chat, Error: %s", err)
+			return
+		case <-chat.EventChan:
+		case <-time.After(5 * time.Second):
+			suite.Fail("Timeout while stopping the chat")
+			return
+		}
+	}
+}
+
+// WaitForEvent waits for the next event of the given type
+func (suite *ChatSuite) WaitForEvent(chat *iwt.Chat, eventType string) iwt.ChatEvent {
+	event := waitForEvent(suite.T(), chat, eventType)
+	suite.Logger.Infof("Received event %s: %s", event.GetType(), event)
+	return event
+}
+
+// The tests that need their own fake server or Client use the helpers below, the ChatSuite uses them too.
+
+// newTestClient creates a Client for the fake server, the options can tune it
+func newTestClient(t *testing.T, ctx context.Context, server *iwttest.Server, options iwt.ClientOptions) *iwt.Client {
+	options.PrimaryAPI = server.APIURL()
+	if options.Logger == nil {
+		options.Logger = logger.Create("test", &logger.NilStream{})
+	}
+	client, err := iwt.NewClient(ctx, options)
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	return client
+}
+
+// newTestFixture starts a fake server with the Sales queue and creates a Client for it, the options can tune the Client
+//
+// The server is closed at the end of the test.
+func newTestFixture(t *testing.T, options iwt.ClientOptions) (*iwttest.Server, *iwt.Client) {
+	server := iwttest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	return server, newTestClient(t, context.Background(), server, options)
+}
+
+// startTestChat starts a chat on the Sales queue, the options can tune it, and gives the chat as seen by the fake server
+//
+// The chat is stopped at the end of the test.
+func startTestChat(t *testing.T, server *iwttest.Server, client *iwt.Client, options iwt.StartChatOptions) (*iwt.Chat, *iwttest.Chat) {
+	if options.Queue == nil {
+		options.Queue = iwt.NewQueue("Workgroup Queue:Sales")
+	}
+	if len(options.Guest.Name) == 0 {
+		options.Guest = iwt.Participant{Name: "UnitTest"}
+	}
+	chat, err := client.StartChat(context.Background(), options)
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	require.NotNil(t, chat, "Chat is nil")
+	t.Cleanup(func() { _ = chat.Stop(context.Background()) })
+	serverChat := server.Chat(chat.ID)
+	require.NotNil(t, serverChat, "The server does not know the chat %s", chat.ID)
+	return chat, serverChat
+}
+
+// waitForEvent waits for the next event of the given type
+func waitForEvent(t *testing.T, chat *iwt.Chat, eventType string) iwt.ChatEvent {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-chat.EventChan:
+			if event.GetType() == eventType {
+				return event
+			}
+		case <-timeout:
+			require.FailNowf(t, "Timeout", "Did not receive a %s event", eventType)
+			return nil
+		}
+	}
+}
+
+// *****************************************************************************
+
+func (suite *ChatSuite) TestCanFetchServerConfiguration() {
+	config, err := suite.Client.GetServerConfiguration(context.Background())
+	suite.Require().Nil(err, "Failed to fetch server configuration, Error: %s", err)
+	suite.Require().NotNil(config, "Failed to fetch server configuration")
+	suite.Assert().Contains(config.Capabilities["chat"], "sendMessage")
+}
+
+func (suite *ChatSuite) TestCanQueryQueue() {
+	queue, err := suite.Client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	suite.Require().Nil(err, "Failed to query queue, Error: %s", err)
+	suite.Assert().Equal(2, queue.AvailableAgents)
+	suite.Assert().Equal(30, queue.EstimatedWaitTime)
+}
+
+func (suite *ChatSuite) TestFailsQueryUnknownQueue() {
+	_, err := suite.Client.QueryQueue(context.Background(), "UnknownQueue", iwt.WorkgroupQueue)
+	suite.Require().NotNil(err)
+	suite.Assert().Equal("error.websvc.unknownEntity.invalidQueue", err.Error())
+	suite.Assert().ErrorIs(err, iwt.StatusUnknownEntityQueue)
+}
+
+func (suite *ChatSuite) TestCanStartAndStopChat() {
+	chat, serverChat := suite.StartChat()
+	suite.Assert().Equal("UnitTest", serverChat.GuestName)
+	suite.Assert().Equal(serverChat.WebUserID, chat.Participants[0].ID)
+	suite.StopChat(chat)
+	suite.Assert().True(serverChat.IsExited(), "The web user should have left the chat")
+	suite.Assert().Len(suite.Server.RequestsTo("/chat/exit/"+serverChat.WebUserID), 1)
+}
+
+func (suite *ChatSuite) TestFailsStartChatWithoutQueue() {
+	_, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Guest: iwt.Participant{Name: "UnitTest"},
+	})
+	suite.Require().NotNil(err, "Should fail to start a chat without a queue")
+	suite.Assert().ErrorIs(err, errors.ArgumentMissing)
+}
+
+func (suite *ChatSuite) TestCanSendMessage() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	err := chat.SendMessage(context.Background(), "Hello World", "")
+	suite.Require().Nil(err, "Failed to send message, Error: %s", err)
+	messages := serverChat.Messages()
+	suite.Require().Len(messages, 1)
+	suite.Assert().Equal("Hello World", messages[0].Text)
+	suite.Assert().Equal("text/plain", messages[0].ContentType)
+}
+
+func (suite *ChatSuite) TestCanReceiveAgentEvents() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.Type(true)
+	agent.SendText("banana")
+	agent.SendURL("https://www.genesys.com")
+	agent.SendFile("minion.txt", "text/plain", []byte("Bello!"))
+
+	joined, ok := suite.WaitForEvent(chat, "participantStateChanged").(*iwt.ParticipantStateChangedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(agent.ID, joined.Participant.ID)
+	suite.Assert().Equal("active", joined.Participant.State)
+
+	typing, ok := suite.WaitForEvent(chat, "typingIndicator").(*iwt.TypingIndicatorEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().True(typing.Typing)
+
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("banana", text.Text)
+	suite.Assert().Equal("Bob Minion", text.Participant.Name)
+
+	link, ok := suite.WaitForEvent(chat, "url").(*iwt.URLEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("https://www.genesys.com", link.URL.String())
+
+	file, ok := suite.WaitForEvent(chat, "file").(*iwt.FileEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	content, err := chat.GetFile(context.Background(), file.Path)
+	suite.Require().Nil(err, "Failed to download file, Error: %s", err)
+	suite.Assert().Equal("Bello!", string(content.Data))
+}
+
+func (suite *ChatSuite) TestShouldIgnoreWebUserEcho() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	err := chat.SendMessage(context.Background(), "Hello World", "")
+	suite.Require().Nil(err, "Failed to send message, Error: %s", err)
+	serverChat.AddAgent("Bob Minion").SendText("banana")
+
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("banana", text.Text, "The echo of the web user message should be ignored")
+}
+
+func (suite *ChatSuite) TestCanGetParticipant() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SetPicture("https://www.acme.com/bob.png")
+
+	participant, err := chat.GetParticipant(context.Background(), agent.ID)
+	suite.Require().Nil(err, "Failed to get participant, Error: %s", err)
+	suite.Assert().Equal("Bob Minion", participant.Name)
+	suite.Require().NotNil(participant.Picture)
+	suite.Assert().Equal("https://www.acme.com/bob.png", participant.Picture.String())
+}
+
+func (suite *ChatSuite) TestShouldStopZombieChat() {
+	chat, serverChat := suite.StartChat()
+	defer suite.Server.ClearFailures()
+
+	suite.Server.Fail("/chat/poll/"+serverChat.WebUserID, iwttest.StatusUnknownSession, 0)
+	suite.WaitForEvent(chat, "stop")
+	suite.Assert().False(chat.IsConnected(), "A zombie chat should be disconnected")
+}
+
+func (suite *ChatSuite) TestShouldKeepPollingOnRetryableStatus() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	suite.Server.Fail("/chat/poll/"+serverChat.WebUserID, iwttest.StatusUnavailable, 1)
+	serverChat.AddAgent("Bob Minion").SendText("Hello")
+	event := suite.WaitForEvent(chat, "text")
+	suite.Require().NotNil(event)
+	suite.Assert().True(chat.IsConnected(), "The chat should still be connected")
+}
+
+func (suite *ChatSuite) TestCanResumeChat() {
+	// The first process starts a chat, receives a message, stores the chat, and dies
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := iwt.NewClient(ctx, iwt.ClientOptions{PrimaryAPI: suite.Server.APIURL(), Logger: suite.Logger})
+	suite.Require().Nil(err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{Name: "UnitTest"},
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	serverChat := suite.Server.Chat(chat.ID)
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SendText("Before the restart")
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("Before the restart", text.Text)
+	state, err := json.Marshal(chat)
+	suite.Require().Nil(err, "Failed to marshal the chat, Error: %s", err)
+	cancel()
+	<-chat.Done()
+
+	// The second process resumes the chat
+	resumed, err := suite.Client.ResumeChat(context.Background(), state, iwt.ResumeChatOptions{})
+	suite.Require().Nil(err, "Failed to resume the chat, Error: %s", err)
+	defer suite.StopChat(resumed)
+	suite.Assert().Equal(chat.ID, resumed.ID)
+	suite.Assert().Equal(serverChat.WebUserID, resumed.Participants[0].ID)
+	suite.Assert().Equal(1, serverChat.Reconnects())
+
+	agent.SendText("After the restart")
+	text, ok = suite.WaitForEvent(resumed, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("After the restart", text.Text, "Events delivered before the restart should not be replayed")
+}
+
+func (suite *ChatSuite) TestFailsResumeUnknownChat() {
+	state := []byte(`{"chatID":"unknown","participants":[{"participantID":"unknown","participantName":"UnitTest"}]}`)
+	_, err := suite.Client.ResumeChat(context.Background(), state, iwt.ResumeChatOptions{})
+	suite.Require().NotNil(err, "Should fail to resume an unknown chat")
+	suite.Assert().ErrorIs(err, iwt.StatusUnknownEntitySession)
+}
+
+func (suite *ChatSuite) TestShouldIgnoreReplayedEvents() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SendText("Before the reconnect")
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("Before the reconnect", text.Text)
+
+	err := chat.Reconnect(context.Background())
+	suite.Require().Nil(err, "Failed to reconnect, Error: %s", err)
+	agent.SendText("After the reconnect")
+	text, ok = suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("After the reconnect", text.Text, "Replayed events should be ignored")
+}
+
+func (suite *ChatSuite) TestCanReorderEvents() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	sequenceNumber := serverChat.SequenceNumber()
+	serverChat.Push(agentTextEvent(agent, "second", sequenceNumber+1))
+	time.Sleep(1500 * time.Millisecond) // the second message comes in an earlier poll
+	serverChat.Push(agentTextEvent(agent, "first", sequenceNumber))
+
+	for _, expected := range []string{"first", "second"} {
+		text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+		suite.Require().True(ok, "Event is not of the proper type")
+		suite.Assert().Equal(expected, text.Text)
+	}
+}
+
+func (suite *ChatSuite) TestShouldReportGaps() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	sequenceNumber := serverChat.SequenceNumber()
+	serverChat.Push(agentTextEvent(agent, "after the gap", sequenceNumber+2))
+
+	gap, ok := suite.WaitForEvent(chat, "gapDetected").(iwt.GapDetectedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(chat.ID, gap.ChatID)
+	suite.Assert().Equal(sequenceNumber, gap.From)
+	suite.Assert().Equal(sequenceNumber+1, gap.To)
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("after the gap", text.Text)
+	suite.Assert().Equal(sequenceNumber+3, chat.NextSequenceNumbers[0])
+}
+
+func (suite *ChatSuite) TestCanTrackSequencePerConversation() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SendText("first conversation")
+	text, ok := suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("first conversation", text.Text)
+
+	// The next conversation has its own sequence numbers
+	event := agentTextEvent(agent, "second conversation", 0)
+	event["conversationSequenceNumber"] = 1
+	serverChat.Push(event)
+	text, ok = suite.WaitForEvent(chat, "text").(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("second conversation", text.Text)
+	suite.Assert().Equal(1, text.ConversationSequenceNumber)
+
+	gap := agentTextEvent(agent, "after a gap", 2)
+	gap["conversationSequenceNumber"] = 1
+	serverChat.Push(gap)
+	detected, ok := suite.WaitForEvent(chat, "gapDetected").(iwt.GapDetectedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(1, detected.Conversation)
+	suite.Assert().Equal(1, detected.From)
+	suite.Assert().Equal(1, detected.To)
+}
+
+func (suite *ChatSuite) TestCanTrackRoster() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	bob := serverChat.AddAgent("Bob Minion")
+	bob.SetPicture("https://www.acme.com/bob.png")
+	roster, ok := suite.WaitForEvent(chat, "rosterChanged").(iwt.RosterChangedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(iwt.ParticipantJoined, roster.Change)
+	suite.Assert().Equal(bob.ID, roster.Participant.ID)
+	suite.Assert().Eventually(func() bool {
+		agents := chat.Agents()
+		return len(agents) == 1 && agents[0].Picture != nil && agents[0].Picture.String() == "https://www.acme.com/bob.png"
+	}, 2*time.Second, 50*time.Millisecond, "Bob should be in the roster with his picture")
+
+	kevin := serverChat.AddAgent("Kevin Minion")
+	roster, ok = suite.WaitForEvent(chat, "rosterChanged").(iwt.RosterChangedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(kevin.ID, roster.Participant.ID)
+	suite.Assert().Len(chat.ActiveParticipants(), 3)
+
+	bob.Disconnect()
+	roster, ok = suite.WaitForEvent(chat, "rosterChanged").(iwt.RosterChangedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal(iwt.ParticipantLeft, roster.Change)
+	suite.Assert().Equal(bob.ID, roster.Participant.ID)
+	agents := chat.Agents()
+	suite.Require().Len(agents, 1)
+	suite.Assert().Equal("Kevin Minion", agents[0].Name)
+	suite.Assert().Len(chat.ActiveParticipants(), 2)
+}
+
+func (suite *ChatSuite) TestShouldNotStopWhenAgentLeaves() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.Disconnect()
+	serverChat.AddAgent("Kevin Minion").SendText("banana")
+	disconnected := false
+	timeout := time.After(5 * time.Second)
+	for received := false; !received; {
+		select {
+		case event := <-chat.EventChan:
+			suite.Require().NotEqual("stop", event.GetType(), "An agent leaving should not stop the chat")
+			if changed, ok := event.(*iwt.ParticipantStateChangedEvent); ok && changed.Participant.ID == agent.ID && changed.Participant.State == "disconnected" {
+				disconnected = true
+			}
+			received = event.GetType() == "text"
+		case <-timeout:
+			suite.FailNow("Did not receive a text event")
+		}
+	}
+	suite.Assert().True(disconnected, "The agent disconnection should be emitted")
+	suite.Assert().True(chat.IsConnected(), "The chat should still be connected")
+}
+
+func (suite *ChatSuite) TestShouldEmitDisconnectionOfUnknownParticipant() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	serverChat.Push(map[string]interface{}{
+		"type":            "participantStateChanged",
+		"participantID":   "unknown-agent",
+		"participantName": "Gru",
+		"displayName":     "Gru",
+		"participantType": "Agent",
+		"state":           "disconnected",
+	})
+	changed, ok := suite.WaitForEvent(chat, "participantStateChanged").(*iwt.ParticipantStateChangedEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("unknown-agent", changed.Participant.ID)
+	suite.Assert().Equal("disconnected", changed.Participant.State)
+}
+
+func (suite *ChatSuite) TestShouldStopWhenWebUserIsDisconnected() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	serverChat.Push(map[string]interface{}{
+		"type":            "participantStateChanged",
+		"participantID":   serverChat.WebUserID,
+		"participantName": "UnitTest",
+		"displayName":     "UnitTest",
+		"participantType": "WebUser",
+		"state":           "disconnected",
+	})
+	suite.WaitForEvent(chat, "stop")
+	suite.Assert().False(chat.IsConnected(), "The chat should be disconnected")
+}
+
+func (suite *ChatSuite) TestCanSetTyping() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+
+	for i := 0; i < 5; i++ {
+		err := chat.SetTyping(context.Background(), true)
+		suite.Require().Nil(err, "Failed to set typing, Error: %s", err)
+	}
+	suite.Assert().True(serverChat.IsTyping(), "The web user should be typing")
+	suite.Assert().Len(suite.Server.RequestsTo("/chat/setTypingState/"), 1, "SetTyping should be debounced")
+
+	err := chat.SetTyping(context.Background(), false)
+	suite.Require().Nil(err, "Failed to set typing, Error: %s", err)
+	suite.Assert().False(serverChat.IsTyping(), "The web user should not be typing")
+	suite.Assert().Len(suite.Server.RequestsTo("/chat/setTypingState/"), 2)
+}
+
+func (suite *ChatSuite) TestShouldDebounceConcurrentTyping() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+	defer suite.Server.ClearFailures()
+
+	suite.Server.Delay("/chat/setTypingState/", 200*time.Millisecond, 1)
+	var group sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			err := chat.SetTyping(context.Background(), true)
+			suite.Assert().Nil(err, "Failed to set typing, Error: %s", err)
+		}()
+	}
+	group.Wait()
+	suite.Assert().True(serverChat.IsTyping(), "The web user should be typing")
+	suite.Assert().Len(suite.Server.RequestsTo("/chat/setTypingState/"+serverChat.WebUserID), 1, "SetTyping should be debounced while a request is in flight")
+}
+
+func (suite *ChatSuite) TestShouldResendTypingAfterFailure() {
+	chat, serverChat := suite.StartChat()
+	defer suite.StopChat(chat)
+	defer suite.Server.ClearFailures()
+
+	suite.Server.Fail("/chat/setTypingState/", iwttest.StatusUnavailable, 0)
+	err := chat.SetTyping(context.Background(), true)
+	suite.Require().NotNil(err, "SetTyping should have failed")
+	suite.Assert().False(serverChat.IsTyping(), "The web user should not be typing")
+	suite.Server.ClearFailures()
+
+	err = chat.SetTyping(context.Background(), true)
+	suite.Require().Nil(err, "Failed to set typing, Error: %s", err)
+	suite.Assert().True(serverChat.IsTyping(), "A failed SetTyping should not be debounced")
+}
+
+func (suite *ChatSuite) TestShouldStopTypingWhenIdle() {
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:             iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:             iwt.Participant{Name: "UnitTest"},
+		TypingIdleTimeout: 200 * time.Millisecond,
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	defer suite.StopChat(chat)
+	serverChat := suite.Server.Chat(chat.ID)
+
+	err = chat.SetTyping(context.Background(), true)
+	suite.Require().Nil(err, "Failed to set typing, Error: %s", err)
+	suite.Assert().True(serverChat.IsTyping(), "The web user should be typing")
+	suite.Assert().Eventually(func() bool { return !serverChat.IsTyping() }, 2*time.Second, 50*time.Millisecond, "The web user should have stopped typing")
+}
+
+func (suite *ChatSuite) TestCanSendAndStopConcurrently() {
+	chat, serverChat := suite.StartChat()
+	serverChat.AddAgent("Bob Minion").SendText("banana")
+
+	go func() {
+		for range chat.EventChan {
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = chat.SendMessage(context.Background(), fmt.Sprintf("Hello %d", i), "")
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := chat.Stop(context.Background())
+			suite.Assert().Nil(err, "Failed to stop a chat, Error: %s", err)
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		suite.Fail("The chat context should be done after Stop")
+	}
+	suite.Assert().False(chat.IsConnected())
+	suite.Assert().Len(suite.Server.RequestsTo("/chat/exit/"+serverChat.WebUserID), 1, "Only one Stop should exit the chat")
+}
+
+func (suite *ChatSuite) TestCanStopWithCanceledContext() {
+	chat, _ := suite.StartChat()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := chat.Stop(ctx)
+	suite.Require().NotNil(err, "Stop should fail with a canceled context")
+	suite.Assert().True(chat.IsConnected(), "The chat should still be connected")
+	suite.StopChat(chat)
+}
+
+func (suite *ChatSuite) TestCanStopWithoutConsumer() {
+	chat, _ := suite.StartChat()
+
+	done := make(chan error)
+	go func() { done <- chat.Stop(context.Background()) }()
+	select {
+	case err := <-done:
+		suite.Require().Nil(err, "Failed to stop a chat, Error: %s", err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("Stop should not block when nobody reads the events")
+	}
+	event := <-chat.EventChan
+	suite.Assert().Equal("stop", event.GetType())
+}
+
+func (suite *ChatSuite) TestShouldDropOutboxWhenNobodyReadsAfterStop() {
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:           iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:           iwt.Participant{Name: "UnitTest"},
+		EventBufferSize: 1,
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	agent := suite.Server.Chat(chat.ID).AddAgent("Bob Minion")
+	for i := 1; i <= 3; i++ {
+		agent.SendText(fmt.Sprintf("message %d", i))
+	}
+	suite.Require().Eventually(func() bool { return len(chat.EventChan) == 1 }, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(200 * time.Millisecond) // let the poll queue its events in the outbox
+	suite.Require().Nil(chat.Stop(context.Background()))
+
+	time.Sleep(3 * time.Second) // longer than the grace period of the outbox
+	suite.Assert().Equal("participantStateChanged", (<-chat.EventChan).GetType())
+	select {
+	case event := <-chat.EventChan:
+		suite.Failf("The outbox should be dropped", "Received %s after the chat was done and nobody read the events", event.GetType())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func (suite *ChatSuite) TestCanDropOldestEventsOnOverflow() {
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:           iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:           iwt.Participant{Name: "UnitTest"},
+		EventBufferSize: 2,
+		OverflowPolicy:  iwt.DropOldestOnOverflow,
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	defer suite.StopChat(chat)
+	agent := suite.Server.Chat(chat.ID).AddAgent("Bob Minion")
+	for i := 1; i <= 5; i++ {
+		agent.SendText(fmt.Sprintf("message %d", i))
+	}
+
+	suite.Require().Eventually(func() bool { return len(chat.EventChan) == 2 }, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(200 * time.Millisecond) // let the poll finish processing its events
+	first, ok := (<-chat.EventChan).(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("message 4", first.Text)
+	second, ok := (<-chat.EventChan).(*iwt.TextEvent)
+	suite.Require().True(ok, "Event is not of the proper type")
+	suite.Assert().Equal("message 5", second.Text)
+}
+
+func (suite *ChatSuite) TestCanReportErrorOnOverflow() {
+	var overflows int32
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:           iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:           iwt.Participant{Name: "UnitTest"},
+		EventBufferSize: 1,
+		OverflowPolicy:  iwt.ErrorOnOverflow,
+		Handlers: iwt.ChatHandlers{
+			OnError: func(chat *iwt.Chat, err error) {
+				suite.Assert().ErrorIs(err, iwt.EventOverflowError)
+				atomic.AddInt32(&overflows, 1)
+			},
+		},
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	agent := suite.Server.Chat(chat.ID).AddAgent("Bob Minion")
+	agent.SendText("message 1")
+	agent.SendText("message 2")
+
+	// the agent joining fills the channel, its roster change and the 2 messages overflow
+	suite.Require().Eventually(func() bool { return atomic.LoadInt32(&overflows) == 3 }, 5*time.Second, 50*time.Millisecond)
+	err = chat.Stop(context.Background())
+	suite.Assert().ErrorIs(err, iwt.EventOverflowError, "The StopEvent should overflow")
+	joined := <-chat.EventChan
+	suite.Assert().Equal("participantStateChanged", joined.GetType())
+}
+
+func (suite *ChatSuite) TestCanStringifyOverflowPolicy() {
+	suite.Assert().Equal("block", iwt.BlockOnOverflow.String())
+	suite.Assert().Equal("drop oldest", iwt.DropOldestOnOverflow.String())
+	suite.Assert().Equal("error", iwt.ErrorOnOverflow.String())
+	suite.Assert().Equal("EventOverflowPolicy(42)", iwt.EventOverflowPolicy(42).String())
+}
+
+func (suite *ChatSuite) TestCanHandleEvents() {
+	texts := make(chan string, 10)
+	stopped := make(chan string, 1)
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{Name: "UnitTest"},
+		Handlers: iwt.ChatHandlers{
+			OnText: func(chat *iwt.Chat, event *iwt.TextEvent) { texts <- event.Text },
+			OnStop: func(chat *iwt.Chat, event iwt.StopEvent) { stopped <- event.ChatID },
+		},
+	})
+	suite.Require().Nil(err, "Failed to start a chat, Error: %s", err)
+	chatID := chat.ID
+	agent := suite.Server.Chat(chatID).AddAgent("Bob Minion")
+	agent.SendText("banana")
+
+	select {
+	case text := <-texts:
+		suite.Assert().Equal("banana", text)
+	case <-time.After(5 * time.Second):
+		suite.Fail("OnText was not called")
+	}
+	err = chat.Stop(context.Background())
+	suite.Require().Nil(err, "Failed to stop a chat, Error: %s", err)
+	select {
+	case id := <-stopped:
+		suite.Assert().Equal(chatID, id)
+	case <-time.After(5 * time.Second):
+		suite.Fail("OnStop was not called")
+	}
+}
+
+// agentTextEvent creates a raw text event sent by the given agent with the given sequence number
+func agentTextEvent(agent *iwttest.Agent, text string, sequenceNumber int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":            "text",
+		"participantID":   agent.ID,
+		"participantName": agent.Name,
+		"displayName":     agent.Name,
+		"participantType": "Agent",
+		"contentType":     "text/plain",
+		"value":           text,
+		"sequenceNumber":  sequenceNumber,
+	}
+}
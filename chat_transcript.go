@@ -0,0 +1,292 @@
+package iwt
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// TranscriptFormat tells how a Transcript is exported
+type TranscriptFormat string
+
+const (
+	// TranscriptJSON exports the transcript as a JSON document
+	TranscriptJSON TranscriptFormat = "json"
+	// TranscriptText exports the transcript as plain text, one line per entry
+	TranscriptText TranscriptFormat = "text"
+	// TranscriptHTML exports the transcript as an HTML document
+	TranscriptHTML TranscriptFormat = "html"
+	// TranscriptCSV exports the transcript as CSV, with a header line
+	TranscriptCSV TranscriptFormat = "csv"
+)
+
+// Transcript records the conversation of a chat
+//
+// A Transcript is attached to a Chat with StartChatOptions.Transcript or Chat.AttachTranscript.
+// It is stored with the chat state, so it survives Reconnect and ResumeChat.
+// The Transcript methods are safe to call from several goroutines.
+type Transcript struct {
+	ChatID     string            `json:"chatID"`
+	DateFormat string            `json:"dateFormat"` // as given by PureConnect, e.g.: M/d/yyyy
+	TimeFormat string            `json:"timeFormat"` // as given by PureConnect, e.g.: h:mm:ss tt
+	Entries    []TranscriptEntry `json:"entries"`
+	mutex      sync.RWMutex
+}
+
+// TranscriptEntry is a message, a URL, a file, or a participant change in a Transcript
+type TranscriptEntry struct {
+	Time            time.Time `json:"time"`
+	Type            string    `json:"type"` // text, url, file, joined, left, or updated
+	ParticipantID   string    `json:"participantID"`
+	ParticipantName string    `json:"participantName"`
+	ParticipantType string    `json:"participantType"`
+	ContentType     string    `json:"contentType,omitempty"`
+	Text            string    `json:"text"` // the message, the URL, the file path, or the new state of the participant
+}
+
+// NewTranscript creates a new empty Transcript
+func NewTranscript() *Transcript {
+	return &Transcript{Entries: []TranscriptEntry{}}
+}
+
+// AttachTranscript attaches a Transcript to the chat, the events received from now on are recorded in it
+func (chat *Chat) AttachTranscript(transcript *Transcript) {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if transcript != nil {
+		transcript.mutex.Lock()
+		transcript.ChatID = chat.ID
+		transcript.DateFormat = chat.DateFormat
+		transcript.TimeFormat = chat.TimeFormat
+		transcript.mutex.Unlock()
+	}
+	chat.Transcript = transcript
+}
+
+// record adds an event of the chat to its transcript, if any
+func (chat *Chat) record(event ChatEvent) {
+	chat.mutex.RLock()
+	transcript := chat.Transcript
+	chat.mutex.RUnlock()
+	if transcript != nil {
+		transcript.Record(event)
+	}
+}
+
+// Record adds a chat event to the transcript
+//
+// Only TextEvent, URLEvent, FileEvent and RosterChangedEvent are recorded.
+func (transcript *Transcript) Record(event ChatEvent) {
+	entry := TranscriptEntry{Time: time.Now(), Type: event.GetType()}
+	var participant Participant
+	switch evt := event.(type) {
+	case *TextEvent:
+		participant, entry.ContentType, entry.Text = evt.Participant, evt.ContentType, evt.Text
+	case *URLEvent:
+		participant, entry.ContentType = evt.Participant, URLContentType
+		if evt.URL != nil {
+			entry.Text = evt.URL.String()
+		}
+	case *FileEvent:
+		participant, entry.ContentType, entry.Text = evt.Participant, evt.ContentType, evt.Path
+	case RosterChangedEvent:
+		participant, entry.Type, entry.Text = evt.Participant, string(evt.Change), evt.Participant.State
+	case *RosterChangedEvent:
+		participant, entry.Type, entry.Text = evt.Participant, string(evt.Change), evt.Participant.State
+	default:
+		return
+	}
+	entry.ParticipantID, entry.ParticipantName, entry.ParticipantType = participant.ID, participant.Name, participant.Type
+
+	transcript.mutex.Lock()
+	defer transcript.mutex.Unlock()
+	transcript.Entries = append(transcript.Entries, entry)
+}
+
+// GetEntries gives a copy of the entries of the transcript
+func (transcript *Transcript) GetEntries() []TranscriptEntry {
+	transcript.mutex.RLock()
+	defer transcript.mutex.RUnlock()
+	return append([]TranscriptEntry{}, transcript.Entries...)
+}
+
+// Timestamp gives the time of an entry formatted with the DateFormat and TimeFormat of the transcript
+func (transcript *Transcript) Timestamp(entry TranscriptEntry) string {
+	transcript.mutex.RLock()
+	defer transcript.mutex.RUnlock()
+	return transcript.timestamp(entry)
+}
+
+// timestamp formats the time of an entry, the caller must hold transcript.mutex
+func (transcript *Transcript) timestamp(entry TranscriptEntry) string {
+	dateFormat, timeFormat := transcript.DateFormat, transcript.TimeFormat
+	if len(dateFormat) == 0 {
+		dateFormat = "yyyy-MM-dd"
+	}
+	if len(timeFormat) == 0 {
+		timeFormat = "HH:mm:ss"
+	}
+	return entry.Time.Format(goTimeLayout(dateFormat) + " " + goTimeLayout(timeFormat))
+}
+
+// Export writes the transcript in the given format
+func (transcript *Transcript) Export(writer io.Writer, format TranscriptFormat) error {
+	transcript.mutex.RLock()
+	defer transcript.mutex.RUnlock()
+
+	switch format {
+	case TranscriptJSON:
+		return transcript.exportJSON(writer)
+	case TranscriptText:
+		return transcript.exportText(writer)
+	case TranscriptHTML:
+		return transcript.exportHTML(writer)
+	case TranscriptCSV:
+		return transcript.exportCSV(writer)
+	}
+	return errors.ArgumentInvalid.With("format", string(format))
+}
+
+// MarshalJSON encodes the transcript into JSON
+func (transcript *Transcript) MarshalJSON() ([]byte, error) {
+	type surrogate Transcript
+	transcript.mutex.RLock()
+	defer transcript.mutex.RUnlock()
+	payload, err := json.Marshal((*surrogate)(transcript))
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
+
+func (transcript *Transcript) exportJSON(writer io.Writer) error {
+	type exportedEntry struct {
+		TranscriptEntry
+		Timestamp string `json:"timestamp"`
+	}
+	entries := make([]exportedEntry, 0, len(transcript.Entries))
+	for _, entry := range transcript.Entries {
+		entries = append(entries, exportedEntry{entry, transcript.timestamp(entry)})
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return errors.JSONMarshalError.Wrap(encoder.Encode(struct {
+		ChatID  string          `json:"chatID"`
+		Entries []exportedEntry `json:"entries"`
+	}{transcript.ChatID, entries}))
+}
+
+func (transcript *Transcript) exportText(writer io.Writer) error {
+	for _, entry := range transcript.Entries {
+		if _, err := fmt.Fprintf(writer, "[%s] %s\n", transcript.timestamp(entry), entry.describe()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+var transcriptHTMLTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Chat {{.ChatID}}</title></head>
+<body>
+<table>
+<tr><th>Time</th><th>Participant</th><th>Message</th></tr>
+{{range .Entries}}<tr class="{{.Type}}"><td>{{.Timestamp}}</td><td>{{.Name}}</td><td>{{if .Link}}<a href="{{.Link}}">{{.Text}}</a>{{else}}{{.Text}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (transcript *Transcript) exportHTML(writer io.Writer) error {
+	type htmlEntry struct {
+		Type      string
+		Timestamp string
+		Name      string
+		Text      string
+		Link      string
+	}
+	entries := make([]htmlEntry, 0, len(transcript.Entries))
+	for _, entry := range transcript.Entries {
+		line := htmlEntry{Type: entry.Type, Timestamp: transcript.timestamp(entry), Name: entry.ParticipantName, Text: entry.Text}
+		switch entry.Type {
+		case "text", "file":
+		case "url":
+			if isSafeLink(entry.Text) {
+				line.Link = entry.Text
+			}
+		default:
+			line.Text = entry.describe()
+		}
+		entries = append(entries, line)
+	}
+	return errors.WithStack(transcriptHTMLTemplate.Execute(writer, struct {
+		ChatID  string
+		Entries []htmlEntry
+	}{transcript.ChatID, entries}))
+}
+
+func (transcript *Transcript) exportCSV(writer io.Writer) error {
+	records := csv.NewWriter(writer)
+	_ = records.Write([]string{"timestamp", "type", "participantID", "participantName", "participantType", "contentType", "text"})
+	for _, entry := range transcript.Entries {
+		_ = records.Write([]string{
+			transcript.timestamp(entry),
+			entry.Type,
+			entry.ParticipantID,
+			entry.ParticipantName,
+			entry.ParticipantType,
+			entry.ContentType,
+			entry.Text,
+		})
+	}
+	records.Flush()
+	return errors.WithStack(records.Error())
+}
+
+// describe gives a one line description of the entry
+func (entry TranscriptEntry) describe() string {
+	switch entry.Type {
+	case "text", "url":
+		return entry.ParticipantName + ": " + entry.Text
+	case "file":
+		return entry.ParticipantName + " sent a file: " + entry.Text
+	case string(ParticipantJoined):
+		return entry.ParticipantName + " joined the chat"
+	case string(ParticipantLeft):
+		return entry.ParticipantName + " left the chat"
+	}
+	return entry.ParticipantName + " is " + entry.Text
+}
+
+// goTimeLayout converts a PureConnect date or time format (e.g.: M/d/yyyy h:mm:ss tt) into a Go time layout
+func goTimeLayout(format string) string {
+	layouts := map[string]string{
+		"yyyy": "2006", "yy": "06",
+		"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+		"dddd": "Monday", "ddd": "Mon", "dd": "02", "d": "2",
+		"HH": "15", "H": "15", "hh": "03", "h": "3",
+		"mm": "04", "m": "4",
+		"ss": "05", "s": "5",
+		"tt": "PM", "t": "PM",
+	}
+	layout := strings.Builder{}
+	runes := []rune(format)
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && runes[end] == runes[start] {
+			end++
+		}
+		token := string(runes[start:end])
+		if converted, found := layouts[token]; found {
+			layout.WriteString(converted)
+		} else {
+			layout.WriteString(token)
+		}
+		start = end
+	}
+	return layout.String()
+}
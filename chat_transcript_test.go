@@ -0,0 +1,126 @@
+package iwt_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanRecordTranscript(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/uri-list"}
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{Transcript: iwt.NewTranscript()})
+	require.NotNil(t, chat.Transcript)
+	assert.Equal(t, chat.ID, chat.Transcript.ChatID)
+	assert.Equal(t, "M/d/yyyy", chat.Transcript.DateFormat)
+
+	err := chat.SendText(context.Background(), "Hello")
+	require.Nil(t, err, "Failed to send message, Error: %s", err)
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.SendText("banana <3")
+	agent.SendURL("https://www.genesys.com")
+	agent.SendFile("minion.png", "image/png", []byte("Bello!"))
+	agent.Disconnect()
+
+	require.Eventually(t, func() bool { return len(chat.Transcript.GetEntries()) == 6 }, 5*time.Second, 50*time.Millisecond)
+	entries := chat.Transcript.GetEntries()
+	assert.Equal(t, "text", entries[0].Type)
+	assert.Equal(t, "Hello", entries[0].Text)
+	assert.Equal(t, "WebUser", entries[0].ParticipantType)
+	assert.Equal(t, "joined", entries[1].Type)
+	assert.Equal(t, "Bob Minion", entries[1].ParticipantName)
+	assert.Equal(t, "text", entries[2].Type)
+	assert.Equal(t, "url", entries[3].Type)
+	assert.Equal(t, "https://www.genesys.com", entries[3].Text)
+	assert.Equal(t, "file", entries[4].Type)
+	assert.Equal(t, "image/png", entries[4].ContentType)
+	assert.Equal(t, "left", entries[5].Type)
+
+	text := bytes.Buffer{}
+	require.Nil(t, chat.Transcript.Export(&text, iwt.TranscriptText))
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.True(t, strings.HasSuffix(lines[0], "] UnitTest: Hello"), "Line: %s", lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], "] Bob Minion joined the chat"), "Line: %s", lines[1])
+	assert.True(t, strings.HasSuffix(lines[5], "] Bob Minion left the chat"), "Line: %s", lines[5])
+
+	page := bytes.Buffer{}
+	require.Nil(t, chat.Transcript.Export(&page, iwt.TranscriptHTML))
+	assert.Contains(t, page.String(), "banana &lt;3")
+	assert.Contains(t, page.String(), `<a href="https://www.genesys.com">https://www.genesys.com</a>`)
+
+	table := bytes.Buffer{}
+	require.Nil(t, chat.Transcript.Export(&table, iwt.TranscriptCSV))
+	records, err := csv.NewReader(&table).ReadAll()
+	require.Nil(t, err, "Failed to read CSV, Error: %s", err)
+	require.Len(t, records, 7)
+	assert.Equal(t, "timestamp", records[0][0])
+	assert.Equal(t, "banana <3", records[3][6])
+
+	document := bytes.Buffer{}
+	require.Nil(t, chat.Transcript.Export(&document, iwt.TranscriptJSON))
+	exported := struct {
+		ChatID  string `json:"chatID"`
+		Entries []struct {
+			Type      string `json:"type"`
+			Timestamp string `json:"timestamp"`
+		} `json:"entries"`
+	}{}
+	require.Nil(t, json.Unmarshal(document.Bytes(), &exported))
+	assert.Equal(t, chat.ID, exported.ChatID)
+	require.Len(t, exported.Entries, 6)
+	assert.NotEmpty(t, exported.Entries[0].Timestamp)
+
+	assert.NotNil(t, chat.Transcript.Export(&document, iwt.TranscriptFormat("pdf")))
+}
+
+func TestShouldKeepTranscriptOnResume(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.Capabilities["contentTypes"] = []string{"text/plain", "text/uri-list"}
+
+	// The first process records the beginning of the chat, stores the chat, and dies
+	ctx, cancel := context.WithCancel(context.Background())
+	chat, serverChat := startTestChat(t, server, newTestClient(t, ctx, server, iwt.ClientOptions{}), iwt.StartChatOptions{Transcript: iwt.NewTranscript()})
+	serverChat.AddAgent("Bob Minion").SendText("Before the restart")
+	require.Eventually(t, func() bool { return len(chat.Transcript.GetEntries()) == 2 }, 5*time.Second, 50*time.Millisecond)
+	state, err := json.Marshal(chat)
+	require.Nil(t, err, "Failed to marshal the chat, Error: %s", err)
+	cancel()
+	<-chat.Done()
+
+	// The second process resumes the chat and its transcript
+	resumed, err := client.ResumeChat(context.Background(), state, iwt.ResumeChatOptions{})
+	require.Nil(t, err, "Failed to resume the chat, Error: %s", err)
+	defer resumed.Stop(context.Background())
+	require.NotNil(t, resumed.Transcript)
+	assert.Len(t, resumed.Transcript.GetEntries(), 2, "The replayed events should not be recorded again")
+
+	serverChat.AddAgent("Stuart Minion").SendText("After the restart")
+	require.Eventually(t, func() bool { return len(resumed.Transcript.GetEntries()) == 4 }, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "After the restart", resumed.Transcript.GetEntries()[3].Text)
+}
+
+func TestCanFormatTranscriptTimestamps(t *testing.T) {
+	entry := iwt.TranscriptEntry{Time: time.Date(2024, 3, 7, 14, 5, 9, 0, time.UTC)}
+	tests := []struct {
+		dateFormat, timeFormat, expected string
+	}{
+		{"M/d/yyyy", "h:mm:ss tt", "3/7/2024 2:05:09 PM"},
+		{"dd/MM/yy", "HH:mm", "07/03/24 14:05"},
+		{"dddd, MMMM d, yyyy", "hh:mm tt", "Thursday, March 7, 2024 02:05 PM"},
+		{"", "", "2024-03-07 14:05:09"},
+	}
+	for _, test := range tests {
+		transcript := iwt.Transcript{DateFormat: test.dateFormat, TimeFormat: test.timeFormat}
+		assert.Equal(t, test.expected, transcript.Timestamp(entry), "Formats: %s %s", test.dateFormat, test.timeFormat)
+	}
+}
@@ -0,0 +1,106 @@
+package iwt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTypingDebounce is how long SetTyping(true) is not sent again to PureConnect
+const DefaultTypingDebounce = 3 * time.Second
+
+// DefaultTypingIdleTimeout is how long after the last SetTyping(true) the web user is considered as having stopped typing
+const DefaultTypingIdleTimeout = 10 * time.Second
+
+// typingIndicator keeps track of the typing state of the web user
+type typingIndicator struct {
+	Debounce    time.Duration
+	IdleTimeout time.Duration
+	typing      bool
+	lastSent    time.Time
+	idleTimer   *time.Timer
+	mutex       sync.Mutex
+}
+
+func newTypingIndicator(debounce, idleTimeout time.Duration) *typingIndicator {
+	if debounce == 0 {
+		debounce = DefaultTypingDebounce
+	}
+	if idleTimeout == 0 {
+		idleTimeout = DefaultTypingIdleTimeout
+	}
+	return &typingIndicator{Debounce: debounce, IdleTimeout: idleTimeout}
+}
+
+// SetTyping tells the agents if the web user is typing or not
+//
+// Calls are debounced: while the web user is typing, PureConnect is told only once per TypingDebounce.
+// If SetTyping(true) is not called again for TypingIdleTimeout, PureConnect is told the web user stopped typing.
+func (chat *Chat) SetTyping(ctx context.Context, typing bool) error {
+	log := chat.Logger.Scope("settyping")
+	chatID, webUser, ok := chat.webUser()
+	if !ok {
+		log.Errorf("chat is not connected")
+		return StatusNotConnectedEntity
+	}
+
+	indicator := chat.typing
+	indicator.mutex.Lock()
+	if indicator.idleTimer != nil {
+		indicator.idleTimer.Stop()
+		indicator.idleTimer = nil
+	}
+	if typing {
+		indicator.idleTimer = time.AfterFunc(indicator.IdleTimeout, func() {
+			log.Debugf("Web user is idle for %s, they stopped typing", indicator.IdleTimeout)
+			if err := chat.SetTyping(chat.context, false); err != nil {
+				log.Errorf("Failed to reset the typing indicator", err)
+			}
+		})
+	}
+	if typing == indicator.typing && (!typing || time.Since(indicator.lastSent) < indicator.Debounce) {
+		indicator.mutex.Unlock()
+		log.Tracef("Typing indicator is already %t, not sending it", typing)
+		return nil
+	}
+	// The state is reserved before it is sent, so concurrent calls are debounced while the request is in flight
+	previousTyping, previousSent := indicator.typing, indicator.lastSent
+	sentAt := time.Now()
+	indicator.typing, indicator.lastSent = typing, sentAt
+	indicator.mutex.Unlock()
+
+	log.Debugf("Sending typing indicator: %t", typing)
+	results := struct {
+		Chat chatResponse `json:"chat"`
+	}{}
+	_, err := chat.post(ctx, "/chat/setTypingState/"+webUser.ID,
+		struct {
+			Typing bool `json:"typingIndicator"`
+		}{typing},
+		&results)
+	if err == nil {
+		chat.deferEvents(results.Chat.Events)
+		err = results.Chat.Status.Param("id", chatID).AsError()
+	}
+	if err != nil {
+		log.Errorf("Failed to send /chat/setTypingState request", err)
+		// The reservation is rolled back, so a failed indicator is sent again on the next call
+		indicator.mutex.Lock()
+		if indicator.typing == typing && indicator.lastSent.Equal(sentAt) {
+			indicator.typing, indicator.lastSent = previousTyping, previousSent
+		}
+		indicator.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// stopTyping stops the idle timer of the typing indicator
+func (chat *Chat) stopTyping() {
+	chat.typing.mutex.Lock()
+	defer chat.typing.mutex.Unlock()
+	if chat.typing.idleTimer != nil {
+		chat.typing.idleTimer.Stop()
+		chat.typing.idleTimer = nil
+	}
+}
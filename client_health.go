@@ -0,0 +1,217 @@
+package iwt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-request"
+)
+
+// DefaultHealthCheckInterval is how often the API endpoints are probed when ClientOptions.HealthCheckInterval is not given
+const DefaultHealthCheckInterval = 30 * time.Second
+
+// DefaultHealthCheckTimeout is how long a probe of an API endpoint can take when ClientOptions.HealthCheckTimeout is not given
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// EndpointHealth describes the health of an API endpoint, as seen by the last check
+type EndpointHealth struct {
+	Endpoint  *url.URL  `json:"endpoint"`
+	Healthy   bool      `json:"healthy"`
+	Active    bool      `json:"active"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Error     error     `json:"-"`
+}
+
+// Health gives the health of each API endpoint, in the order of Client.APIEndpoints
+func (client *Client) Health() []EndpointHealth {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	health := make([]EndpointHealth, len(client.health))
+	copy(health, client.health)
+	for index := range health {
+		health[index].Active = index == client.EndPointIndex
+	}
+	return health
+}
+
+// CheckHealth probes the /serverConfiguration of all API endpoints and switches to the best healthy one
+//
+// The primary endpoint is preferred, so the Client fails back to it as soon as it recovers.
+// When the Client switches, every live Chat receives a SwitchoverEvent and reconnects to the new endpoint.
+// Returns StatusUnavailableService if no API endpoint is healthy.
+func (client *Client) CheckHealth(ctx context.Context) error {
+	log := client.Logger.Child("health", "check")
+
+	client.healthMutex.Lock()
+	defer client.healthMutex.Unlock()
+
+	health := make([]EndpointHealth, len(client.APIEndpoints))
+	best := -1
+	for index, endpoint := range client.APIEndpoints {
+		health[index] = client.probe(ctx, endpoint)
+		if health[index].Healthy && best < 0 {
+			best = index
+		}
+	}
+	client.mutex.Lock()
+	client.health = health
+	current := client.EndPointIndex
+	client.mutex.Unlock()
+
+	if best < 0 {
+		log.Errorf("No API endpoint is available")
+		return StatusUnavailableService
+	}
+	if best != current {
+		client.switchover(current, best)
+	}
+	return nil
+}
+
+// checkHealthSoon checks the health of the API endpoints in the background, unless such a check is already running
+//
+// The chats call it when they fail to poll, so many chats on a failing endpoint cause one check, not one each.
+func (client *Client) checkHealthSoon() {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.checkingHealth {
+		return
+	}
+	client.checkingHealth = true
+	go func() {
+		_ = client.CheckHealth(client.Context)
+		client.mutex.Lock()
+		client.checkingHealth = false
+		client.mutex.Unlock()
+	}()
+}
+
+// probe checks if the given API endpoint can serve requests
+func (client *Client) probe(ctx context.Context, endpoint *url.URL) EndpointHealth {
+	log := client.Logger.Child("health", "probe", "endpoint", endpoint.String())
+
+	health := EndpointHealth{Endpoint: endpoint, CheckedAt: time.Now()}
+	results := []struct {
+		Config struct {
+			Version int    `json:"cfgVer"`
+			Status  Status `json:"status"`
+		} `json:"serverConfiguration"`
+	}{}
+	// The codec is negotiated as in send, so a server that speaks only XML is healthy too
+	var content *request.Content
+	for {
+		codec := client.currentCodec()
+		content, health.Error = request.Send(&request.Options{
+			Context:   ctx,
+			URL:       client.URLWithPath(endpoint.String() + "/serverConfiguration"),
+			UserAgent: "GENESYS IWT Client " + VERSION,
+			Accept:    codec.ContentType(),
+			Transport: client.Transport,
+			Attempts:  1,
+			Timeout:   client.HealthCheckTimeout,
+			Logger:    log,
+		}, nil)
+		if !client.detectCodec(codec, content, health.Error) || health.Error == nil {
+			break
+		}
+	}
+	if health.Error == nil && content != nil {
+		if err := client.codecFor(content.Type).Unmarshal(content.Data, &results); err != nil {
+			health.Error = err
+		}
+	}
+	if health.Error == nil {
+		if len(results) == 0 {
+			health.Error = StatusUnavailableService
+		} else if status := results[0].Config.Status; len(status.Type) > 0 && !status.IsOK() {
+			health.Error = status
+		}
+	}
+	health.Healthy = health.Error == nil
+	if !health.Healthy {
+		log.Warnf("API endpoint is not healthy: %s", health.Error)
+	}
+	return health
+}
+
+// switchover makes the Client use another API endpoint and reconnects all live chats to it
+func (client *Client) switchover(from, to int) {
+	client.mutex.Lock()
+	client.EndPointIndex = to
+	client.configuration = nil // the other endpoint may have another configuration
+	chats := make([]*Chat, 0, len(client.chats))
+	for chat := range client.chats {
+		chats = append(chats, chat)
+	}
+	client.mutex.Unlock()
+
+	client.Metrics.SwitchedOver()
+	client.Logger.Child("health", "switchover").Warnf("Switching over from %s to %s (%d chats)", client.APIEndpoints[from], client.APIEndpoints[to], len(chats))
+	for _, chat := range chats {
+		go chat.switchover(client.APIEndpoints[from], client.APIEndpoints[to])
+	}
+}
+
+// watchHealth checks the health of the API endpoints regularly, until the Client context is done
+func (client *Client) watchHealth(interval time.Duration) {
+	log := client.Logger.Child("health", "watch")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("Checking the health of %d API endpoints every %s", len(client.APIEndpoints), interval)
+	for {
+		select {
+		case <-client.Context.Done():
+			log.Debugf("Client context is done: %s", client.Context.Err())
+			return
+		case <-ticker.C:
+			_ = client.CheckHealth(client.Context)
+		}
+	}
+}
+
+// registerChat adds a chat to the live chats that are reconnected on switchover
+func (client *Client) registerChat(chat *Chat) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if _, found := client.chats[chat]; !found {
+		client.chats[chat] = struct{}{}
+		client.Metrics.ChatStarted()
+	}
+}
+
+// unregisterChat removes a chat from the live chats
+func (client *Client) unregisterChat(chat *Chat) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if _, found := client.chats[chat]; found {
+		delete(client.chats, chat)
+		client.Metrics.ChatEnded()
+	}
+}
+
+// isEndpointFailure tells if the given error means the API endpoint cannot serve requests
+//
+// i.e.: connection errors, HTTP 5xx, and StatusUnavailableService.
+func isEndpointFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status Status
+	if errors.As(err, &status) {
+		return status.IsA(StatusUnavailableService)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var httpErr *errors.Error
+	if errors.As(err, &httpErr) && httpErr.Code >= http.StatusInternalServerError {
+		return true
+	}
+	return IsRetryable(err)
+}
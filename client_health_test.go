@@ -0,0 +1,188 @@
+package iwt_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSwitchoverTestClient(t *testing.T, interval time.Duration) (*iwt.Client, *iwttest.Server, *iwttest.Server) {
+	primary := iwttest.NewServer()
+	t.Cleanup(primary.Close)
+	primary.AddQueue("Sales", "Workgroup", 1, 0)
+	backup := iwttest.NewBackupServer(primary)
+	t.Cleanup(backup.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	client := newTestClient(t, ctx, primary, iwt.ClientOptions{
+		BackupAPI:           backup.APIURL(),
+		HealthCheckInterval: interval,
+	})
+	return client, primary, backup
+}
+
+func TestClientCanFailOverAndBack(t *testing.T) {
+	client, primary, backup := newSwitchoverTestClient(t, 200*time.Millisecond)
+	chat, _ := startTestChat(t, primary, client, iwt.StartChatOptions{})
+
+	primary.FailHTTP("/", http.StatusInternalServerError, 0)
+	event := waitForEvent(t, chat, "switchover").(iwt.SwitchoverEvent)
+	assert.Equal(t, primary.APIURL().String(), event.From)
+	assert.Equal(t, backup.APIURL().String(), event.To)
+	assert.Equal(t, backup.APIURL().String(), client.CurrentAPIEndpoint().String())
+	health := client.Health()
+	require.Len(t, health, 2)
+	assert.False(t, health[0].Healthy)
+	assert.True(t, health[1].Healthy)
+	assert.True(t, health[1].Active)
+	assert.Eventually(t, func() bool { return len(backup.RequestsTo("/chat/reconnect")) == 1 }, 2*time.Second, 50*time.Millisecond)
+
+	primary.ClearFailures()
+	event = waitForEvent(t, chat, "switchover").(iwt.SwitchoverEvent)
+	assert.Equal(t, backup.APIURL().String(), event.From)
+	assert.Equal(t, primary.APIURL().String(), event.To)
+	assert.Equal(t, primary.APIURL().String(), client.CurrentAPIEndpoint().String())
+	assert.True(t, chat.IsConnected(), "The chat should still be connected")
+}
+
+func TestChatCanSwitchOverWhenPollingIsUnavailable(t *testing.T) {
+	client, primary, backup := newSwitchoverTestClient(t, time.Hour)
+	chat, serverChat := startTestChat(t, primary, client, iwt.StartChatOptions{})
+
+	primary.Fail("/chat/poll", iwttest.StatusUnavailable, 0)
+	primary.Fail("/serverConfiguration", iwttest.StatusUnavailable, 0)
+	waitForEvent(t, chat, "switchover")
+	assert.Equal(t, backup.APIURL().String(), client.CurrentAPIEndpoint().String())
+
+	serverChat.AddAgent("Bob Minion").SendText("Hello from the backup")
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-chat.EventChan:
+			if text, ok := event.(*iwt.TextEvent); ok && text.Text == "Hello from the backup" {
+				assert.Eventually(t, func() bool { return len(backup.RequestsTo("/chat/poll")) > 0 }, 5*time.Second, 100*time.Millisecond)
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "Did not receive the agent message through the backup server")
+		}
+	}
+}
+
+func TestChatsOnFailingEndpointShareHealthCheck(t *testing.T) {
+	primary := iwttest.NewServer()
+	t.Cleanup(primary.Close)
+	primary.AddQueue("Sales", "Workgroup", 1, 0)
+	backup := iwttest.NewBackupServer(primary)
+	t.Cleanup(backup.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	client := newTestClient(t, ctx, primary, iwt.ClientOptions{
+		BackupAPI:           backup.APIURL(),
+		HealthCheckInterval: time.Hour,
+		RetryPolicy:         &iwt.NoRetry, // each failed poll is one request
+	})
+	chats := make([]*iwt.Chat, 8)
+	for index := range chats {
+		chats[index], _ = startTestChat(t, primary, client, iwt.StartChatOptions{})
+	}
+	probes := len(primary.RequestsTo("/serverConfiguration"))
+	polls := len(primary.RequestsTo("/chat/poll"))
+
+	// The primary still looks healthy, so the check does not switch over and the chats keep failing while it runs
+	primary.Delay("/serverConfiguration", 4*time.Second, 1)
+	primary.Fail("/chat/poll", iwttest.StatusUnavailable, 0)
+	require.Eventually(t, func() bool {
+		return len(primary.RequestsTo("/chat/poll"))-polls >= 2*len(chats)
+	}, 3500*time.Millisecond, 50*time.Millisecond, "The chats should keep polling while the health is checked")
+
+	primary.ClearFailures()
+	require.Eventually(t, func() bool { return !client.Health()[0].CheckedAt.IsZero() }, 5*time.Second, 50*time.Millisecond)
+	polls = len(primary.RequestsTo("/chat/poll"))
+	require.Eventually(t, func() bool {
+		return len(primary.RequestsTo("/chat/poll"))-polls >= 2*len(chats)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 1, len(primary.RequestsTo("/serverConfiguration"))-probes, "The failing chats should share the health check")
+}
+
+func TestShouldFetchServerConfigurationAgainAfterSwitchover(t *testing.T) {
+	client, primary, backup := newSwitchoverTestClient(t, time.Hour)
+	backup.AddQueue("Sales", "Workgroup", 1, 0)
+	backup.Capabilities["contentTypes"] = []string{"text/plain", "text/html"}
+	chat, _ := startTestChat(t, primary, client, iwt.StartChatOptions{})
+	assert.Equal(t, []string{"text/plain"}, chat.ContentTypes)
+
+	primary.Fail("/serverConfiguration", iwttest.StatusUnavailable, 0)
+	_ = client.CheckHealth(context.Background())
+	require.Equal(t, backup.APIURL().String(), client.CurrentAPIEndpoint().String())
+
+	chat, _ = startTestChat(t, backup, client, iwt.StartChatOptions{})
+	assert.Equal(t, []string{"text/plain", "text/html"}, chat.ContentTypes, "The configuration of the backup should be used")
+}
+
+func TestChatKeepsPollingWhenReconnectFails(t *testing.T) {
+	client, primary, backup := newSwitchoverTestClient(t, time.Hour)
+	chat, serverChat := startTestChat(t, primary, client, iwt.StartChatOptions{})
+
+	backup.FailHTTP("/chat/reconnect", http.StatusInternalServerError, 0)
+	primary.Fail("/chat/poll", iwttest.StatusUnavailable, 0)
+	primary.Fail("/serverConfiguration", iwttest.StatusUnavailable, 0)
+	waitForEvent(t, chat, "switchover")
+	assert.Eventually(t, func() bool { return len(backup.RequestsTo("/chat/reconnect")) > 0 }, 5*time.Second, 50*time.Millisecond)
+
+	serverChat.AddAgent("Bob Minion").SendText("Hello after a failed reconnect")
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-chat.EventChan:
+			if text, ok := event.(*iwt.TextEvent); ok && text.Text == "Hello after a failed reconnect" {
+				assert.True(t, chat.IsConnected(), "The chat should still be connected")
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "The chat stopped polling after the failed reconnect")
+		}
+	}
+}
+
+func TestChatStopsWhenReconnectIsFatal(t *testing.T) {
+	client, primary, backup := newSwitchoverTestClient(t, time.Hour)
+	chat, _ := startTestChat(t, primary, client, iwt.StartChatOptions{})
+
+	backup.Fail("/chat/reconnect", iwttest.StatusUnknownSession, 0)
+	primary.Fail("/chat/poll", iwttest.StatusUnavailable, 0)
+	primary.Fail("/serverConfiguration", iwttest.StatusUnavailable, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-chat.EventChan:
+			if _, ok := event.(iwt.StopEvent); ok {
+				assert.False(t, chat.IsConnected(), "The chat should be disconnected")
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "Did not receive a stop event")
+		}
+	}
+}
+
+func TestClientDoesNotCheckHealthWithoutBackup(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newTestClient(t, ctx, server, iwt.ClientOptions{HealthCheckInterval: 50 * time.Millisecond})
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, server.RequestsTo("/serverConfiguration"))
+	require.Nil(t, client.CheckHealth(context.Background()))
+	assert.True(t, client.Health()[0].Healthy)
+	assert.Len(t, server.RequestsTo("/serverConfiguration"), 1)
+}
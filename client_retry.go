@@ -0,0 +1,282 @@
+package iwt
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-request"
+)
+
+// RetryPolicy defines how the requests sent to PureConnect are sent again when they fail
+//
+// A request that PureConnect rejected (connection refused, HTTP 429 or 503, a retryable Status) is always sent again.
+// A request that PureConnect may have processed already (timeout, connection reset, other HTTP errors)
+// is sent again only if it is idempotent, so a message is never sent twice.
+//
+// The delay between two attempts starts at InitialDelay and is multiplied by Multiplier after each attempt,
+// up to MaxDelay, then Jitter (a fraction of the delay) is randomly added or removed.
+type RetryPolicy struct {
+	MaxAttempts        int           `json:"maxAttempts"` // 1 means the request is sent only once
+	InitialDelay       time.Duration `json:"initialDelay"`
+	MaxDelay           time.Duration `json:"maxDelay"`
+	Multiplier         float64       `json:"multiplier"`
+	Jitter             float64       `json:"jitter"`             // 0 means no jitter
+	RetryableStatuses  []Status      `json:"retryableStatuses"`  // default: StatusUnavailableService, StatusUnknownError
+	RetryableHTTPCodes []int         `json:"retryableHTTPCodes"` // default: 408, 429, 500, 502, 503, 504
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a Client, if none is given in the ClientOptions
+//
+// Fields that are not set in a given RetryPolicy are taken from DefaultRetryPolicy, except Jitter.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:        3,
+	InitialDelay:       200 * time.Millisecond,
+	MaxDelay:           5 * time.Second,
+	Multiplier:         2,
+	Jitter:             0.2,
+	RetryableStatuses:  retryableStatuses,
+	RetryableHTTPCodes: []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// NoRetry is a RetryPolicy that sends the requests only once
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// rejectedHTTPCodes are the HTTP status codes that tell PureConnect did not process the request
+var rejectedHTTPCodes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+// idempotentOperations are the operations that can be sent again even if PureConnect may have processed them already
+//
+// Operations sent with GET are always idempotent.
+var idempotentOperations = map[string]bool{
+	"serverConfiguration": true,
+	"queue/query":         true,
+	"partyInfo":           true,
+	"chat/poll":           true,
+	"chat/setTypingState": true,
+	"chat/exit":           true,
+	"callback/status":     true,
+	"callback/modify":     true,
+	"callback/disconnect": true,
+	"registration/login":  true,
+}
+
+// withDefaults gives the policy with the fields that are not set taken from DefaultRetryPolicy
+func (policy RetryPolicy) withDefaults() RetryPolicy {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = DefaultRetryPolicy.InitialDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if policy.RetryableStatuses == nil {
+		policy.RetryableStatuses = DefaultRetryPolicy.RetryableStatuses
+	}
+	if policy.RetryableHTTPCodes == nil {
+		policy.RetryableHTTPCodes = DefaultRetryPolicy.RetryableHTTPCodes
+	}
+	return policy
+}
+
+// delay gives how long to wait after the given failed attempt (starting at 1)
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := float64(policy.InitialDelay) * math.Pow(policy.Multiplier, float64(attempt-1))
+	if delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	return jittered(time.Duration(delay), policy.Jitter)
+}
+
+// shouldRetry tells if a request that failed with the given error should be sent again
+func (policy RetryPolicy) shouldRetry(err error, idempotent bool) bool {
+	var status Status
+	if errors.As(err, &status) {
+		for _, retryable := range policy.RetryableStatuses {
+			if status.IsA(retryable) {
+				return true
+			}
+		}
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true // the request never reached PureConnect
+	}
+	var httpErr *errors.Error
+	if errors.As(err, &httpErr) && httpErr.Code >= http.StatusBadRequest {
+		if !containsCode(policy.RetryableHTTPCodes, httpErr.Code) {
+			return false
+		}
+		return idempotent || containsCode(rejectedHTTPCodes, httpErr.Code)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return idempotent
+	}
+	return false
+}
+
+// retryPolicy gives the RetryPolicy of the given operation
+func (client *Client) retryPolicy(operation string) RetryPolicy {
+	if policy, found := client.RetryPolicies[operation]; found {
+		return policy.withDefaults()
+	}
+	return client.RetryPolicy.withDefaults()
+}
+
+// multipartPayload is a payload of send that is uploaded as a multipart form with a file, instead of being encoded
+type multipartPayload struct {
+	Fields      map[string]string // the form fields, ">file" gives the name of the file
+	ContentType string            // the content type of the file
+	Open        func() io.Reader  // gives the content of the file, it is called for each attempt
+}
+
+// send sends a request to PureConnect, and sends it again according to the RetryPolicy of its operation
+//
+// The payload is encoded and the results are decoded with the Codec of the Client.
+// A multipartPayload is uploaded as is.
+// The language, if any, is sent as Accept-Language.
+// When the request still fails with a Status after the last attempt, the Status is in the results, not in the error.
+func (client *Client) send(ctx context.Context, method, path, language string, payload, results interface{}) (*request.Content, error) {
+	operation := operationOf(path)
+	policy := client.retryPolicy(operation)
+	idempotent := method == http.MethodGet || idempotentOperations[operation]
+	headers := map[string]string{}
+	if len(language) > 0 {
+		headers["Accept-Language"] = language
+	}
+	injectTraceContext(ctx, headers)
+	for attempt := 1; ; attempt++ {
+		codec := client.currentCodec()
+		options := &request.Options{
+			Context:   ctx,
+			Method:    method,
+			URL:       client.URLWithPath(path),
+			UserAgent: "GENESYS IWT Client " + VERSION,
+			Headers:   headers,
+			Transport: client.Transport,
+			Attempts:  1,
+			Logger:    client.Logger,
+		}
+		if upload, ok := payload.(multipartPayload); ok {
+			options.Payload = upload.Fields
+			options.Attachment = upload.Open()
+			options.AttachmentType = upload.ContentType
+		} else if payload != nil {
+			body, err := codec.Marshal(payload)
+			if err != nil {
+				return nil, err
+			}
+			options.Payload = request.ContentWithData(body, codec.ContentType())
+		}
+		if results != nil {
+			options.Accept = codec.ContentType()
+		}
+		start := time.Now()
+		content, err := request.Send(options, nil)
+		duration := time.Since(start)
+		if client.detectCodec(codec, content, err) && err != nil {
+			client.Metrics.ObserveRequest(operation, metricReason(err), duration)
+			attempt-- // the request was refused because of its format, this is not a failed attempt
+			continue
+		}
+		if err == nil && results != nil && content != nil && len(content.Data) > 0 {
+			resetResults(results) // so nothing is left from a previous attempt (e.g. its status)
+			if err := client.codecFor(content.Type).Unmarshal(content.Data, results); err != nil {
+				client.Logger.Child("request", "send", "operation", operation).Debugf("Failed to decode the response body, use the Content: %s", err)
+			}
+		}
+		failure := err
+		if failure == nil {
+			failure = client.responseStatus(content)
+		}
+		client.Metrics.ObserveRequest(operation, metricReason(failure), duration)
+		if failure == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.shouldRetry(failure, idempotent) {
+			return content, err
+		}
+		delay := policy.delay(attempt)
+		client.Logger.Child("request", "send", "operation", operation).Warnf("Attempt %d/%d failed, sending again in %s: %s", attempt, policy.MaxAttempts, delay, failure)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return content, err
+		}
+	}
+}
+
+// resetResults sets the value pointed to by results back to its zero value
+func resetResults(results interface{}) {
+	if value := reflect.ValueOf(results); value.Kind() == reflect.Ptr && !value.IsNil() {
+		value.Elem().Set(reflect.Zero(value.Elem().Type()))
+	}
+}
+
+// operationOf gives the operation of a request path (e.g. "/chat/sendMessage/1234" => "chat/sendMessage")
+func operationOf(path string) string {
+	segments := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	switch segments[0] {
+	case "chat", "callback", "queue", "registration":
+		if len(segments) > 1 {
+			return segments[0] + "/" + segments[1]
+		}
+	}
+	return segments[0]
+}
+
+// responseStatus gives the failed Status of an IWT response, if any
+//
+// IWT responses have a single root (chat, callback, queue, etc) that holds the status.
+func (client *Client) responseStatus(content *request.Content) error {
+	if content == nil || len(content.Data) == 0 {
+		return nil
+	}
+	type root map[string]struct {
+		Status *Status `json:"status"`
+	}
+	// Some responses are arrays (e.g. serverConfiguration), the shape is checked first so the payload is decoded once
+	codec := client.codecFor(content.Type)
+	roots := []root{}
+	if isArrayPayload(codec, content.Data) {
+		if err := codec.Unmarshal(content.Data, &roots); err != nil {
+			return nil
+		}
+	} else {
+		single := root{}
+		if err := codec.Unmarshal(content.Data, &single); err != nil {
+			return nil
+		}
+		roots = append(roots, single)
+	}
+	for _, root := range roots {
+		for _, response := range root {
+			if response.Status != nil && len(response.Status.Type) > 0 {
+				return response.Status.AsError()
+			}
+		}
+	}
+	return nil
+}
+
+// containsCode tells if the given HTTP status code is in the list
+func containsCode(codes []int, code int) bool {
+	for _, item := range codes {
+		if item == code {
+			return true
+		}
+	}
+	return false
+}
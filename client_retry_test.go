@@ -0,0 +1,79 @@
+package iwt_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetryPolicy retries quickly so the tests do not wait
+var fastRetryPolicy = iwt.RetryPolicy{MaxAttempts: 3, InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+func TestShouldRetryFailedRequests(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &fastRetryPolicy})
+
+	server.Fail("/queue/query", iwttest.StatusUnavailable, 2)
+	queue, err := client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	require.Nil(t, err, "Failed to query the queue, Error: %s", err)
+	assert.Equal(t, 1, queue.AvailableAgents)
+	assert.Len(t, server.RequestsTo("/queue/query"), 3)
+
+	server.FailHTTP("/queue/query", http.StatusBadGateway, 3)
+	_, err = client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	assert.NotNil(t, err, "The query should fail after the last attempt")
+	assert.Len(t, server.RequestsTo("/queue/query"), 6)
+
+	server.Fail("/queue/query", iwttest.StatusUnknownQueue, 1)
+	_, err = client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	assert.ErrorIs(t, err, iwt.StatusUnknownEntityQueue)
+	assert.Len(t, server.RequestsTo("/queue/query"), 7, "Non retryable statuses should not be retried")
+}
+
+func TestShouldRetryFailedStatusesOfArraysAndObjects(t *testing.T) {
+	for _, codec := range []iwt.Codec{iwt.JSONCodec{}, iwt.XMLCodec{}} {
+		server, client := newTestFixture(t, iwt.ClientOptions{Codec: codec, RetryPolicy: &fastRetryPolicy})
+
+		server.Fail("/serverConfiguration", iwttest.StatusUnavailable, 1)
+		_, err := client.GetServerConfiguration(context.Background())
+		require.Nil(t, err, "Failed to fetch server configuration in %s, Error: %s", codec.ContentType(), err)
+		assert.Len(t, server.RequestsTo("/serverConfiguration"), 2, "The status of an array should be found in %s", codec.ContentType())
+
+		server.Fail("/queue/query", iwttest.StatusUnavailable, 1)
+		_, err = client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+		require.Nil(t, err, "Failed to query the queue in %s, Error: %s", codec.ContentType(), err)
+		assert.Len(t, server.RequestsTo("/queue/query"), 2, "The status of an object should be found in %s", codec.ContentType())
+	}
+}
+
+func TestShouldNotDuplicateMessages(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &fastRetryPolicy})
+	chat, _ := startTestChat(t, server, client, iwt.StartChatOptions{})
+
+	server.FailHTTP("/chat/sendMessage", http.StatusInternalServerError, 1)
+	err := chat.SendText(context.Background(), "Hello")
+	assert.NotNil(t, err, "A message that may have been accepted should not be sent again")
+	assert.Len(t, server.RequestsTo("/chat/sendMessage"), 1)
+
+	server.FailHTTP("/chat/sendMessage", http.StatusServiceUnavailable, 1)
+	err = chat.SendText(context.Background(), "Hello")
+	require.Nil(t, err, "A message that was rejected should be sent again, Error: %s", err)
+	assert.Len(t, server.RequestsTo("/chat/sendMessage"), 3)
+}
+
+func TestCanRetryPerOperation(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{
+		RetryPolicy:   &fastRetryPolicy,
+		RetryPolicies: map[string]iwt.RetryPolicy{"queue/query": iwt.NoRetry},
+	})
+
+	server.Fail("/queue/query", iwttest.StatusUnavailable, 1)
+	_, err := client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	assert.ErrorIs(t, err, iwt.StatusUnavailableService)
+	assert.Len(t, server.RequestsTo("/queue/query"), 1)
+}
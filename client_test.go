@@ -46,11 +46,11 @@ func (suite *IWTTestSuite) SetupSuite() {
 	primaryAPI, err := url.Parse(core.GetEnvAsString("PRIMARY", ""))
 	suite.Require().Nil(err, "Failed to parse Primary PureConnect URL")
 
-	suite.Client = iwt.NewClient(context.Background(), iwt.ClientOptions{
+	suite.Client, err = iwt.NewClient(context.Background(), iwt.ClientOptions{
 		PrimaryAPI: primaryAPI,
 		Logger:     suite.Logger,
 	})
-	suite.Require().NotNil(suite.Client, "Failed to instantiate a new IWT Client")
+	suite.Require().Nil(err, "Failed to instantiate a new IWT Client, Error: %s", err)
 
 	suite.Logger.Infof("Suite Start %s %s", suite.Name, strings.Repeat("=", 80-14-len(suite.Name)))
 }
@@ -88,7 +88,7 @@ func (suite *IWTTestSuite) TestCanInstantiate() {
 }
 
 func (suite *IWTTestSuite) TestCanFetchServerConfiguration() {
-	config, err := suite.Client.GetServerConfiguration()
+	config, err := suite.Client.GetServerConfiguration(context.Background())
 	suite.Require().Nil(err, "Failed to fetch server configuration, Error: %s", err)
 	suite.Require().NotNil(config, "Failed to fetch server configuration")
 	suite.Assert().NotEmpty(config.Capabilities, "No capabilities")
@@ -103,20 +103,20 @@ func (suite *IWTTestSuite) TestCanFetchServerConfiguration() {
 }
 
 func (suite *IWTTestSuite) TestCanQueryQueue() {
-	queue, err := suite.Client.QueryQueue("Line", iwt.WorkgroupQueue)
+	queue, err := suite.Client.QueryQueue(context.Background(), "Line", iwt.WorkgroupQueue)
 	suite.Require().Nil(err, "Failed to query queue, Error: %s", err)
 	suite.Client.Logger.Infof("Queue: %#v", queue)
 }
 
 func (suite *IWTTestSuite) TestFailsQueryUnknownQueue() {
-	queue, err := suite.Client.QueryQueue("UnknownQueue", iwt.WorkgroupQueue)
+	queue, err := suite.Client.QueryQueue(context.Background(), "UnknownQueue", iwt.WorkgroupQueue)
 	suite.Require().NotNil(err)
 	suite.Assert().Equal("error.websvc.unknownEntity.invalidQueue", err.Error())
 	suite.Client.Logger.Infof("Queue: %#v", queue)
 }
 
 func (suite *IWTTestSuite) TestCanStartAndStopChat() {
-	chat, err := suite.Client.StartChat(iwt.StartChatOptions{
+	chat, err := suite.Client.StartChat(context.Background(), iwt.StartChatOptions{
 		Queue: &iwt.Queue{Type: iwt.WorkgroupQueue, Name: "Line"},
 		Guest: iwt.Participant{Name: "UnitTest"},
 	})
@@ -126,6 +126,6 @@ func (suite *IWTTestSuite) TestCanStartAndStopChat() {
 	suite.Client.Logger.Infof("Chat: %#v", chat)
 
 	time.Sleep(5 * time.Second)
-	err = chat.Stop()
+	err = chat.Stop(context.Background())
 	suite.Require().Nil(err, "Failed to stop a chat, Error: %s", err)
 }
@@ -0,0 +1,165 @@
+package iwt_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCanUseCACert(t *testing.T) {
+	server := iwttest.NewTLSServer()
+	defer server.Close()
+
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI: server.APIURL(),
+		CACert:     server.CACert(),
+		Logger:     logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	config, err := client.GetServerConfiguration(context.Background())
+	require.Nil(t, err, "Failed to fetch server configuration, Error: %s", err)
+	assert.Contains(t, config.Capabilities, "chat")
+}
+
+func TestClientFailsWithoutCACert(t *testing.T) {
+	server := iwttest.NewTLSServer()
+	defer server.Close()
+
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI: server.APIURL(),
+		Logger:     logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	_, err = client.GetServerConfiguration(context.Background())
+	require.NotNil(t, err, "The server certificate should not be trusted")
+}
+
+func TestClientFailsWithInvalidCertificates(t *testing.T) {
+	_, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		CACert: []byte("not a certificate"),
+		Logger: logger.Create("test", &logger.NilStream{}),
+	})
+	assert.ErrorIs(t, err, errors.ArgumentInvalid, "An invalid CA certificate should be refused")
+
+	_, err = iwt.NewClient(context.Background(), iwt.ClientOptions{
+		ClientCertificate: []byte("not a certificate"),
+		ClientKey:         []byte("not a key"),
+		Logger:            logger.Create("test", &logger.NilStream{}),
+	})
+	assert.ErrorIs(t, err, errors.ArgumentInvalid, "An invalid client certificate should be refused")
+}
+
+func TestClientCanUseClientCertificate(t *testing.T) {
+	certificate, key := newClientCertificate(t)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certificate))
+
+	server := iwttest.NewUnstartedServer()
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:        server.APIURL(),
+		CACert:            server.CACert(),
+		ClientCertificate: certificate,
+		ClientKey:         key,
+		Logger:            logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	_, err = client.GetServerConfiguration(context.Background())
+	require.Nil(t, err, "Failed to fetch server configuration, Error: %s", err)
+
+	anonymous, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI: server.APIURL(),
+		CACert:     server.CACert(),
+		Logger:     logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	_, err = anonymous.GetServerConfiguration(context.Background())
+	require.NotNil(t, err, "The server should require a client certificate")
+}
+
+func TestClientCanUseProxy(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+
+	var proxied int32
+	var authorization atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		authorization.Store(r.Header.Get("Proxy-Authorization"))
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for key, values := range res.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(res.StatusCode)
+		_, _ = io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "s3cr3t")
+
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI: server.APIURL(),
+		Proxy:      proxyURL,
+		Logger:     logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	_, err = client.GetServerConfiguration(context.Background())
+	require.Nil(t, err, "Failed to fetch server configuration, Error: %s", err)
+	_, err = client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	require.Nil(t, err, "Failed to query queue, Error: %s", err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&proxied))
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:s3cr3t")), authorization.Load())
+}
+
+// newClientCertificate creates a self-signed client certificate and its key, PEM encoded
+func newClientCertificate(t *testing.T) (certificate []byte, key []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err, "Failed to generate a key, Error: %s", err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-iwt test client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	require.Nil(t, err, "Failed to create a certificate, Error: %s", err)
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	require.Nil(t, err, "Failed to marshal the key, Error: %s", err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
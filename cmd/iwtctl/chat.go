@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+)
+
+// chat starts an interactive chat in the terminal
+//
+// Every line typed by the user is sent as a message, except for the commands:
+//
+//	/file <path>  sends a file
+//	/quit         leaves the chat
+func (app *application) chat(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("chat", flag.ContinueOnError)
+	flags.SetOutput(app.Stderr)
+	queueName := flags.String("queue", "", `queue to chat with (e.g.: "Workgroup Queue:Sales")`)
+	guestName := flags.String("name", "iwtctl", "name of the web user")
+	language := flags.String("language", "", "language of the chat (e.g.: en-us)")
+	stateFile := flags.String("state", "", "file where the chat state is stored, for the party command")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*queueName) == 0 {
+		return errors.ArgumentMissing.With("queue")
+	}
+
+	saveState := func(*iwt.Chat) {}
+	if len(*stateFile) > 0 {
+		saveState = func(chat *iwt.Chat) {
+			if payload, err := json.Marshal(chat); err == nil {
+				_ = os.WriteFile(*stateFile, payload, 0o600)
+			}
+		}
+	}
+	stopped := make(chan struct{}) // closed when the first StopEvent was shown
+	var stopOnce sync.Once
+	chat, err := app.Client.StartChat(ctx, iwt.StartChatOptions{
+		Queue:    iwt.NewQueue(*queueName),
+		Guest:    iwt.Participant{Name: *guestName},
+		Language: *language,
+		Handlers: iwt.ChatHandlers{
+			OnText: func(chat *iwt.Chat, event *iwt.TextEvent) {
+				app.Output.Event(event, "[%s] %s: %s", now(), event.Participant.Name, event.Text)
+			},
+			OnURL: func(chat *iwt.Chat, event *iwt.URLEvent) {
+				app.Output.Event(event, "[%s] %s sent a link: %s", now(), event.Participant.Name, event.URL)
+			},
+			OnFile: func(chat *iwt.Chat, event *iwt.FileEvent) {
+				app.Output.Event(event, "[%s] %s sent a file: %s", now(), event.Participant.Name, chat.GetFileURL(event.Path))
+			},
+			OnTyping: func(chat *iwt.Chat, event *iwt.TypingIndicatorEvent) {
+				app.Output.Event(event, "[%s] %s is %s", now(), event.Participant.Name, event)
+			},
+			OnRosterChanged: func(chat *iwt.Chat, event iwt.RosterChangedEvent) {
+				app.Output.Event(event, "[%s] %s %s the chat (%s)", now(), event.Participant.Name, event.Change, event.Participant.ID)
+				saveState(chat)
+			},
+			OnStop: func(chat *iwt.Chat, event iwt.StopEvent) {
+				app.Output.Event(event, "[%s] The chat is over", now())
+				stopOnce.Do(func() { close(stopped) })
+			},
+			OnError: func(chat *iwt.Chat, err error) {
+				app.Output.Event(struct {
+					Error string `json:"error"`
+				}{err.Error()}, "[%s] Error: %s", now(), err)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	saveState(chat)
+	app.Output.Event(struct {
+		ChatID string `json:"chatID"`
+	}{chat.ID}, "[%s] Chat %s started on %s, type /quit to leave", now(), chat.ID, chat.Queue)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(app.Stdin)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-chat.Done():
+				return
+			}
+		}
+	}()
+
+	// leave stops the chat and waits for the StopEvent to be shown
+	leave := func(ctx context.Context) (err error) {
+		err = chat.Stop(ctx)
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+		}
+		return
+	}
+	for {
+		select {
+		case <-chat.Done():
+			return leave(ctx)
+		case <-ctx.Done():
+			return leave(context.Background())
+		case line, ok := <-lines:
+			if !ok {
+				return leave(ctx)
+			}
+			if err := app.chatCommand(ctx, chat, strings.TrimSpace(line)); err != nil {
+				if errors.Is(err, errQuit) {
+					return leave(ctx)
+				}
+				app.Output.Event(struct {
+					Error string `json:"error"`
+				}{err.Error()}, "[%s] Error: %s", now(), err)
+			}
+		}
+	}
+}
+
+// errQuit is returned by chatCommand when the user wants to leave the chat
+var errQuit = errors.New("quit")
+
+// chatCommand runs a line typed by the user in the chat
+func (app *application) chatCommand(ctx context.Context, chat *iwt.Chat, line string) error {
+	switch {
+	case len(line) == 0:
+		return nil
+	case line == "/quit":
+		return errQuit
+	case strings.HasPrefix(line, "/file "):
+		path := strings.TrimSpace(strings.TrimPrefix(line, "/file "))
+		file, err := os.Open(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer file.Close()
+		return chat.SendFile(ctx, filepath.Base(path), "", file)
+	case strings.HasPrefix(line, "/"):
+		return errors.ArgumentInvalid.With("command", line)
+	default:
+		return chat.SendText(ctx, line)
+	}
+}
+
+// now gives the current time to prefix the events with
+func now() string {
+	return time.Now().Format("15:04:05")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// config shows the configuration of the PureConnect server
+func (app *application) config(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.SetOutput(app.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := app.Client.GetServerConfiguration(ctx)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{
+		{"version", strconv.Itoa(config.Version)},
+		{"maxMessageLength", strconv.Itoa(config.MaxMessageLength)},
+	}
+	features := make([]string, 0, len(config.Capabilities))
+	for feature := range config.Capabilities {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	for _, feature := range features {
+		rows = append(rows, []string{"capabilities." + feature, strings.Join(config.Capabilities[feature], ", ")})
+	}
+	return app.Output.Print(config, []string{"SETTING", "VALUE"}, rows)
+}
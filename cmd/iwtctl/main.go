@@ -0,0 +1,149 @@
+// iwtctl is a command line client for the GENESYS PureConnect Interaction Web Tools API
+//
+// Usage:
+//
+//	iwtctl [options] <command> [command options] [arguments]
+//
+// Commands:
+//
+//	config                         shows the configuration of the PureConnect server
+//	queue query <queue>            shows the status of a queue (e.g.: "Workgroup Queue:Sales")
+//	chat --queue <queue>           starts an interactive chat in the terminal
+//	party --state <file> <id>...   shows participants of a chat stored by "chat --state"
+//
+// The API endpoints can be given with the IWT_PRIMARY and IWT_BACKUP environment variables.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-logger"
+)
+
+// application holds what the commands share
+type application struct {
+	Client *iwt.Client
+	Output output
+	Stdin  io.Reader
+	Stderr io.Writer
+	Logger *logger.Logger
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs iwtctl with the given arguments (without the program name)
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("iwtctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	primary := flags.String("primary", os.Getenv("IWT_PRIMARY"), "URL of the primary IWT API (env: IWT_PRIMARY)")
+	backup := flags.String("backup", os.Getenv("IWT_BACKUP"), "URL of the backup IWT API (env: IWT_BACKUP)")
+	cacert := flags.String("cacert", "", "PEM file with the CA certificate of the IWT API")
+	proxy := flags.String("proxy", "", "URL of the proxy (http, https, or socks5)")
+	language := flags.String("language", "", "language of the chats (e.g.: en-us)")
+	format := flags.String("output", "table", "output format: table or json")
+	logDestination := flags.String("log", "", "where to write the logs (e.g.: file:///tmp/iwtctl.log), none by default")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: iwtctl [options] <command> [command options] [arguments]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		fmt.Fprintln(stderr, "  config                         shows the configuration of the PureConnect server")
+		fmt.Fprintln(stderr, "  queue query <queue>            shows the status of a queue (e.g.: \"Workgroup Queue:Sales\")")
+		fmt.Fprintln(stderr, "  chat --queue <queue>           starts an interactive chat in the terminal")
+		fmt.Fprintln(stderr, "  party --state <file> <id>...   shows participants of a chat stored by \"chat --state\"")
+		fmt.Fprintln(stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.ArgumentMissing.With("command")
+	}
+
+	out, err := newOutput(*format, stdout)
+	if err != nil {
+		return err
+	}
+	log := logger.Create("iwtctl", &logger.NilStream{})
+	if len(*logDestination) > 0 {
+		log = logger.Create("iwtctl", *logDestination)
+	}
+	options := iwt.ClientOptions{Language: *language, Logger: log}
+	if options.PrimaryAPI, err = parseURL("primary", *primary); err != nil {
+		return err
+	}
+	if options.BackupAPI, err = parseURL("backup", *backup); err != nil {
+		return err
+	}
+	if options.Proxy, err = parseURL("proxy", *proxy); err != nil {
+		return err
+	}
+	if len(*cacert) > 0 {
+		if options.CACert, err = os.ReadFile(*cacert); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// Canceling the client context detaches from the chats without leaving them
+	clientCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client, err := iwt.NewClient(clientCtx, options)
+	if err != nil {
+		return err
+	}
+	app := &application{
+		Client: client,
+		Output: out,
+		Stdin:  stdin,
+		Stderr: stderr,
+		Logger: log,
+	}
+
+	switch command := flags.Arg(0); command {
+	case "config":
+		err = app.config(ctx, flags.Args()[1:])
+	case "queue":
+		err = app.queue(ctx, flags.Args()[1:])
+	case "chat":
+		err = app.chat(ctx, flags.Args()[1:])
+	case "party":
+		err = app.party(ctx, flags.Args()[1:])
+	default:
+		flags.Usage()
+		return errors.ArgumentInvalid.With("command", command)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// parseURL parses an optional URL given in the options
+func parseURL(name, value string) (*url.URL, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 {
+		return nil, errors.ArgumentInvalid.With(name, value)
+	}
+	return parsed, nil
+}
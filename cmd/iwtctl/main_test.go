@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runIWTCtl(t *testing.T, server *iwttest.Server, stdin io.Reader, args ...string) (string, error) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	args = append([]string{"--primary", server.URL}, args...)
+	err := run(context.Background(), args, stdin, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestCanShowConfiguration(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+
+	output, err := runIWTCtl(t, server, nil, "config")
+	require.Nil(t, err, "Failed to run config, Error: %s", err)
+	assert.Contains(t, output, "SETTING")
+	assert.Contains(t, output, "capabilities.chat")
+
+	output, err = runIWTCtl(t, server, nil, "--output", "json", "config")
+	require.Nil(t, err, "Failed to run config, Error: %s", err)
+	config := struct {
+		Version int `json:"cfgVer"`
+	}{}
+	require.Nil(t, json.Unmarshal([]byte(output), &config))
+	assert.Equal(t, 1, config.Version)
+}
+
+func TestCanQueryQueue(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 3, 20)
+
+	output, err := runIWTCtl(t, server, nil, "queue", "query", "Workgroup Queue:Sales")
+	require.Nil(t, err, "Failed to run queue query, Error: %s", err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, []string{"Workgroup", "Queue:Sales", "3", "20"}, strings.Fields(lines[1]))
+
+	output, err = runIWTCtl(t, server, nil, "--output", "json", "queue", "query", "Workgroup Queue:Sales")
+	require.Nil(t, err, "Failed to run queue query, Error: %s", err)
+	queue := struct {
+		Name   string `json:"queueName"`
+		Agents int    `json:"agentsAvailable"`
+	}{}
+	require.Nil(t, json.Unmarshal([]byte(output), &queue))
+	assert.Equal(t, "Sales", queue.Name)
+	assert.Equal(t, 3, queue.Agents)
+
+	_, err = runIWTCtl(t, server, nil, "queue", "query", "Workgroup Queue:Marketing")
+	assert.NotNil(t, err, "The queue should not be found")
+}
+
+func TestCanChat(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	stateFile := filepath.Join(t.TempDir(), "chat.json")
+
+	stdin, input := io.Pipe()
+	done := make(chan error)
+	var output string
+	go func() {
+		var err error
+		output, err = runIWTCtl(t, server, stdin, "chat", "--queue", "Workgroup Queue:Sales", "--name", "Tester", "--state", stateFile)
+		done <- err
+	}()
+	serverChat := server.WaitForChat(5 * time.Second)
+	require.NotNil(t, serverChat, "The chat was not started")
+	agent := serverChat.AddAgent("Bob Minion")
+	require.Eventually(t, func() bool {
+		state, _ := os.ReadFile(stateFile)
+		return bytes.Contains(state, []byte(agent.ID))
+	}, 5*time.Second, 50*time.Millisecond, "The state file should contain the agent")
+
+	party, err := runIWTCtl(t, server, nil, "party", "--state", stateFile, agent.ID)
+	require.Nil(t, err, "Failed to run party, Error: %s", err)
+	assert.Contains(t, party, "Bob Minion")
+	assert.Empty(t, server.RequestsTo("/chat/reconnect"), "The party command should not take over the chat")
+
+	_, _ = io.WriteString(input, "Hello\n")
+	require.Eventually(t, func() bool { return len(serverChat.Messages()) == 1 }, 5*time.Second, 50*time.Millisecond)
+	_, _ = io.WriteString(input, "/quit\n")
+	select {
+	case err := <-done:
+		require.Nil(t, err, "Failed to run chat, Error: %s", err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "The chat command did not stop")
+	}
+	assert.Equal(t, "Hello", serverChat.Messages()[0].Text)
+	assert.True(t, serverChat.IsExited())
+	assert.Contains(t, output, "Bob Minion joined the chat")
+}
+
+func TestFailsWithUnknownCommand(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+
+	_, err := runIWTCtl(t, server, nil, "dance")
+	assert.NotNil(t, err)
+	_, err = runIWTCtl(t, server, nil, "--output", "xml", "config")
+	assert.NotNil(t, err)
+}
+
+func TestFailsWithInvalidCACert(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	cacert := filepath.Join(t.TempDir(), "cacert.pem")
+	require.Nil(t, os.WriteFile(cacert, []byte("not a certificate"), 0600))
+
+	_, err := runIWTCtl(t, server, nil, "--cacert", cacert, "config")
+	assert.NotNil(t, err, "An invalid CA certificate should be refused")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gildas/go-errors"
+)
+
+// output writes the results of the commands as tables or as JSON
+//
+// It is safe to call from several goroutines.
+type output struct {
+	JSON   bool
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+// newOutput creates an output in the given format (table or json)
+func newOutput(format string, writer io.Writer) (output, error) {
+	switch strings.ToLower(format) {
+	case "table", "":
+		return output{writer: writer, mutex: &sync.Mutex{}}, nil
+	case "json":
+		return output{JSON: true, writer: writer, mutex: &sync.Mutex{}}, nil
+	}
+	return output{}, errors.ArgumentInvalid.With("output", format)
+}
+
+// Print writes the value as JSON, or the rows as a table with the given headers
+func (out output) Print(value interface{}, headers []string, rows [][]string) error {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.JSON {
+		encoder := json.NewEncoder(out.writer)
+		encoder.SetIndent("", "  ")
+		return errors.JSONMarshalError.Wrap(encoder.Encode(value))
+	}
+	table := tabwriter.NewWriter(out.writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return errors.WithStack(table.Flush())
+}
+
+// Event writes a chat event as a JSON line, or the given text line
+func (out output) Event(value interface{}, format string, args ...interface{}) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.JSON {
+		if payload, err := json.Marshal(value); err == nil {
+			fmt.Fprintln(out.writer, string(payload))
+		}
+		return
+	}
+	fmt.Fprintf(out.writer, format+"\n", args...)
+}
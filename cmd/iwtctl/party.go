@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+)
+
+// party shows participants of a chat
+//
+// The chat is read from the state stored by "chat --state", it is neither reconnected nor polled:
+// the chat command keeps running it.
+func (app *application) party(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("party", flag.ContinueOnError)
+	flags.SetOutput(app.Stderr)
+	stateFile := flags.String("state", "", "file where the chat state was stored by the chat command")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*stateFile) == 0 {
+		return errors.ArgumentMissing.With("state")
+	}
+	if flags.NArg() == 0 {
+		return errors.ArgumentMissing.With("participant")
+	}
+	payload, err := os.ReadFile(*stateFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	state := iwt.Chat{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	if len(state.Participants) == 0 {
+		return errors.ArgumentMissing.With("participants")
+	}
+	webUserID := state.Participants[0].ID
+
+	participants := []*iwt.Participant{}
+	rows := [][]string{}
+	for _, id := range flags.Args() {
+		participant, err := app.Client.GetParticipant(ctx, webUserID, id)
+		if err != nil {
+			return err
+		}
+		picture := ""
+		if participant.Picture != nil {
+			picture = participant.Picture.String()
+		}
+		participants = append(participants, participant)
+		rows = append(rows, []string{participant.ID, participant.Name, participant.Type, picture})
+	}
+	if app.Output.JSON && len(participants) == 1 {
+		return app.Output.Print(participants[0], nil, nil)
+	}
+	return app.Output.Print(participants, []string{"ID", "NAME", "TYPE", "PICTURE"}, rows)
+}
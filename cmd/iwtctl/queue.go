@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+)
+
+// queue runs the queue subcommands
+func (app *application) queue(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.ArgumentMissing.With("queue command")
+	}
+	switch command := args[0]; command {
+	case "query":
+		return app.queueQuery(ctx, args[1:])
+	default:
+		return errors.ArgumentInvalid.With("queue command", command)
+	}
+}
+
+// queueQuery shows the status of the given queues
+func (app *application) queueQuery(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("queue query", flag.ContinueOnError)
+	flags.SetOutput(app.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.ArgumentMissing.With("queue")
+	}
+
+	queues := []*iwt.Queue{}
+	rows := [][]string{}
+	for _, qualifiedQueue := range flags.Args() {
+		queue := iwt.NewQueue(qualifiedQueue)
+		queue, err := app.Client.QueryQueue(ctx, queue.Name, queue.Type)
+		if err != nil {
+			return err
+		}
+		queues = append(queues, queue)
+		rows = append(rows, []string{queue.String(), strconv.Itoa(queue.AvailableAgents), strconv.Itoa(queue.EstimatedWaitTime)})
+	}
+	if app.Output.JSON && len(queues) == 1 {
+		return app.Output.Print(queues[0], nil, nil)
+	}
+	return app.Output.Print(queues, []string{"QUEUE", "AGENTS", "ESTIMATED WAIT"}, rows)
+}
@@ -0,0 +1,529 @@
+package iwt
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-request"
+)
+
+// Codec encodes the requests sent to PureConnect and decodes its responses
+//
+// PureConnect speaks JSON and XML, see JSONCodec and XMLCodec.
+type Codec interface {
+	// ContentType gives the MIME type of the payloads (e.g. "application/json")
+	ContentType() string
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(payload []byte, value interface{}) error
+}
+
+// JSONCodec is the Codec for JSON, the default wire format of PureConnect
+type JSONCodec struct{}
+
+// XMLCodec is the Codec for XML, used by the PureConnect servers that have JSON disabled
+//
+// The XML documents mirror the JSON ones: their root element is <iwt>, each JSON property is an element with the same name,
+// and the items of a JSON array are repeated elements. The items of a top-level array are <item> elements.
+// Properties whose name is not a valid XML name (e.g. the keys of attributes) are <entry key="name"> elements.
+// When decoding, the attributes of an element are read like child elements with the same name,
+// so <status type="success"/> and <status><type>success</type></status> are the same. Requests are encoded with elements only.
+//
+// This mapping is derived from the JSON documents of the IWT API, it was not checked against the XML of a PureConnect server.
+//
+// As XML has no types, values are decoded according to the Go type of their destination (i.e. its JSON tags).
+type XMLCodec struct{}
+
+const (
+	xmlRootName  = "iwt"
+	xmlItemName  = "item"
+	xmlEntryName = "entry"
+	xmlKeyName   = "key"
+)
+
+// ContentType gives the MIME type of the payloads
+func (codec JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal encodes the value in JSON
+func (codec JSONCodec) Marshal(value interface{}) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	return payload, errors.JSONMarshalError.Wrap(err)
+}
+
+// Unmarshal decodes the JSON payload into the value
+func (codec JSONCodec) Unmarshal(payload []byte, value interface{}) error {
+	return errors.JSONUnmarshalError.Wrap(json.Unmarshal(payload, value))
+}
+
+// ContentType gives the MIME type of the payloads
+func (codec XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+// Marshal encodes the value in XML
+//
+// The value is encoded as in JSON first, so its MarshalJSON method is used, if any.
+func (codec XMLCodec) Marshal(value interface{}) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.JSONMarshalError.Wrap(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	buffer := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(buffer)
+	root := xml.StartElement{Name: xml.Name{Local: xmlRootName}}
+	if err = encoder.EncodeToken(root); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = writeXMLContent(encoder, decoder, xmlItemName); err != nil {
+		return nil, err
+	}
+	if err = encoder.EncodeToken(root.End()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = encoder.Flush(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Unmarshal decodes the XML payload into the value
+//
+// The XML is converted to JSON according to the type of the value, so its UnmarshalJSON method is used, if any.
+func (codec XMLCodec) Unmarshal(payload []byte, value interface{}) error {
+	root, err := readXMLNode(xml.NewDecoder(bytes.NewReader(payload)))
+	if err != nil {
+		return err
+	}
+	buffer := &bytes.Buffer{}
+	valueType := reflect.TypeOf(value)
+	if valueType != nil && valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if kind := indirectType(valueType); kind != nil && (kind.Kind() == reflect.Slice || kind.Kind() == reflect.Array) {
+		writeJSONArray(buffer, root.children, kind.Elem())
+	} else {
+		writeJSONValue(buffer, root, valueType)
+	}
+	return errors.JSONUnmarshalError.Wrap(json.Unmarshal(buffer.Bytes(), value))
+}
+
+// currentCodec gives the Codec the Client uses to encode its requests
+func (client *Client) currentCodec() Codec {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	return client.codec
+}
+
+// codecFor gives the Codec to decode a response of the given content type
+func (client *Client) codecFor(contentType string) Codec {
+	codec := client.currentCodec()
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == codec.ContentType():
+		return codec
+	case strings.Contains(mediaType, "xml"):
+		return XMLCodec{}
+	case strings.Contains(mediaType, "json"):
+		return JSONCodec{}
+	}
+	return codec
+}
+
+// detectCodec switches the Client to XMLCodec if the server refused the request sent with the given codec or answered in XML
+//
+// This happens only once, when the Client has no Codec in its ClientOptions.
+// It tells if the Client switched.
+func (client *Client) detectCodec(codec Codec, content *request.Content, err error) bool {
+	var httpErr *errors.Error
+	refused := errors.As(err, &httpErr) && (httpErr.Code == http.StatusUnsupportedMediaType || httpErr.Code == http.StatusNotAcceptable)
+	answeredXML := err == nil && content != nil && strings.Contains(content.Type, "xml")
+	if !refused && !answeredXML {
+		return false
+	}
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if !client.detectingCodec || client.codec != codec {
+		return false
+	}
+	if _, isXML := codec.(XMLCodec); isXML {
+		return false
+	}
+	client.Logger.Child("codec", "detect").Infof("The server does not accept %s, switching to XML", codec.ContentType())
+	client.codec = XMLCodec{}
+	client.detectingCodec = false
+	return true
+}
+
+// writeXMLContent writes the next JSON value as the content of the current XML element
+//
+// The items of an array are written as elements named itemName.
+func writeXMLContent(encoder *xml.Encoder, decoder *json.Decoder, itemName string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return errors.JSONUnmarshalError.Wrap(err)
+				}
+				if err = writeXMLElement(encoder, decoder, key.(string)); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for decoder.More() {
+				if err = writeXMLElement(encoder, decoder, itemName); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = decoder.Token() // the closing delimiter
+		return errors.JSONUnmarshalError.Wrap(err)
+	case nil:
+		return nil
+	case string:
+		return errors.WithStack(encoder.EncodeToken(xml.CharData(value)))
+	case json.Number:
+		return errors.WithStack(encoder.EncodeToken(xml.CharData(value.String())))
+	case bool:
+		return errors.WithStack(encoder.EncodeToken(xml.CharData(strconv.FormatBool(value))))
+	}
+	return nil
+}
+
+// writeXMLElement writes the next JSON value as an element with the given name
+//
+// Arrays are written as repeated elements, null values are not written.
+func writeXMLElement(encoder *xml.Encoder, decoder *json.Decoder, name string) error {
+	if !decoder.More() {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: xmlEntryName}, Attr: []xml.Attr{{Name: xml.Name{Local: xmlKeyName}, Value: name}}}
+	}
+
+	// Peek at the value to handle arrays and nulls
+	raw := json.RawMessage{}
+	if err := decoder.Decode(&raw); err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	inner := json.NewDecoder(bytes.NewReader(trimmed))
+	inner.UseNumber()
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if _, err := inner.Token(); err != nil {
+			return errors.JSONUnmarshalError.Wrap(err)
+		}
+		for inner.More() {
+			if err := writeXMLElement(encoder, inner, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := writeXMLContent(encoder, inner, xmlItemName); err != nil {
+		return err
+	}
+	return errors.WithStack(encoder.EncodeToken(start.End()))
+}
+
+// isXMLName tells if the name can be used as an XML element name
+func isXMLName(name string) bool {
+	if len(name) == 0 || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for index, r := range name {
+		switch {
+		case r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z'):
+		case index > 0 && (r == '-' || r == '.' || ('0' <= r && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// xmlNode is an element of an XML document
+type xmlNode struct {
+	name     string // the key attribute of <entry> elements
+	text     string
+	children []*xmlNode // the attributes, then the child elements
+}
+
+// child gives the first child with the given name
+func (node *xmlNode) child(name string) *xmlNode {
+	for _, child := range node.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// readXMLNode reads the next element of the XML document
+//
+// The attributes of the elements become child nodes, except the namespace declarations and the key of <entry> elements.
+func readXMLNode(decoder *xml.Decoder) (*xmlNode, error) {
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.ArgumentInvalid.With("payload", "no XML element")
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: element.Name.Local}
+			for _, attribute := range element.Attr {
+				switch {
+				case len(attribute.Name.Space) > 0 || attribute.Name.Local == "xmlns":
+					// namespace declarations and qualified attributes are not part of the values
+				case element.Name.Local == xmlEntryName && attribute.Name.Local == xmlKeyName:
+					node.name = attribute.Value
+				default:
+					node.children = append(node.children, &xmlNode{name: attribute.Name.Local, text: attribute.Value})
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(element)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			if stack = stack[:len(stack)-1]; len(stack) == 0 {
+				return node, nil
+			}
+		}
+	}
+}
+
+// isArrayPayload tells if the payload holds a top-level array, without decoding it
+//
+// A JSON array starts with '[', an XML array is a root element whose children are <item> elements.
+func isArrayPayload(codec Codec, payload []byte) bool {
+	if _, ok := codec.(XMLCodec); !ok {
+		trimmed := bytes.TrimSpace(payload)
+		return len(trimmed) > 0 && trimmed[0] == '['
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(payload))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				return element.Name.Local == xmlItemName
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+var (
+	jsonUnmarshalerType  = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	chatEventType        = reflect.TypeOf((*ChatEvent)(nil)).Elem()
+	chatEventWrapperType = reflect.TypeOf(chatEventWrapper{})
+	participantType      = reflect.TypeOf(Participant{})
+)
+
+// indirectType gives the type pointed to by the given type
+func indirectType(valueType reflect.Type) reflect.Type {
+	for valueType != nil && valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	return valueType
+}
+
+// writeJSONValue writes the XML node as a JSON value of the given type (nil if unknown)
+func writeJSONValue(buffer *bytes.Buffer, node *xmlNode, valueType reflect.Type) {
+	valueType = indirectType(valueType)
+	if valueType == nil || valueType.Kind() == reflect.Interface {
+		if len(node.children) > 0 {
+			writeJSONObject(buffer, node, func(string) reflect.Type { return nil })
+		} else {
+			writeJSONString(buffer, node.text)
+		}
+		return
+	}
+	if valueType == chatEventWrapperType {
+		eventType := participantType
+		if header := node.child("type"); header != nil {
+			if registered, found := chatEventRegistry[strings.TrimSpace(header.text)]; found {
+				eventType = registered
+			}
+		}
+		writeJSONObject(buffer, node, eventFields(eventType))
+		return
+	}
+	isUnmarshaler := reflect.PointerTo(valueType).Implements(jsonUnmarshalerType) || reflect.PointerTo(valueType).Implements(textUnmarshalerType)
+	switch valueType.Kind() {
+	case reflect.Struct:
+		if isUnmarshaler && len(node.children) == 0 {
+			writeJSONString(buffer, node.text) // e.g. URLs
+			return
+		}
+		if valueType.Implements(chatEventType) {
+			writeJSONObject(buffer, node, eventFields(valueType))
+			return
+		}
+		writeJSONObject(buffer, node, structFields(valueType))
+	case reflect.Map:
+		writeJSONObject(buffer, node, func(string) reflect.Type { return valueType.Elem() })
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			writeJSONString(buffer, strings.TrimSpace(node.text)) // []byte are base64 strings
+			return
+		}
+		writeJSONArray(buffer, node.children, valueType.Elem())
+	case reflect.Bool:
+		text := strings.TrimSpace(node.text)
+		if _, err := strconv.ParseBool(text); err == nil {
+			buffer.WriteString(strings.ToLower(text))
+		} else if len(text) == 0 {
+			buffer.WriteString("false")
+		} else {
+			writeJSONString(buffer, text)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		text := strings.TrimSpace(node.text)
+		if isUnmarshaler {
+			writeJSONString(buffer, text) // e.g. QueueType
+		} else if _, err := strconv.ParseFloat(text, 64); err == nil {
+			buffer.WriteString(text)
+		} else if len(text) == 0 {
+			buffer.WriteString("0")
+		} else {
+			writeJSONString(buffer, text)
+		}
+	default:
+		writeJSONString(buffer, node.text)
+	}
+}
+
+// writeJSONObject writes the children of the XML node as the properties of a JSON object
+//
+// fieldType gives the type of each property, children with the same name are an array if the property is a slice.
+func writeJSONObject(buffer *bytes.Buffer, node *xmlNode, fieldType func(name string) reflect.Type) {
+	names := []string{}
+	children := map[string][]*xmlNode{}
+	for _, child := range node.children {
+		if _, found := children[child.name]; !found {
+			names = append(names, child.name)
+		}
+		children[child.name] = append(children[child.name], child)
+	}
+	buffer.WriteByte('{')
+	for index, name := range names {
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+		writeJSONString(buffer, name)
+		buffer.WriteByte(':')
+		valueType := indirectType(fieldType(name))
+		switch {
+		case valueType != nil && (valueType.Kind() == reflect.Slice || valueType.Kind() == reflect.Array) && valueType.Elem().Kind() != reflect.Uint8:
+			writeJSONArray(buffer, children[name], valueType.Elem())
+		case valueType == nil && len(children[name]) > 1:
+			writeJSONArray(buffer, children[name], nil)
+		default:
+			writeJSONValue(buffer, children[name][0], valueType)
+		}
+	}
+	buffer.WriteByte('}')
+}
+
+// writeJSONArray writes the XML nodes as the items of a JSON array
+func writeJSONArray(buffer *bytes.Buffer, nodes []*xmlNode, itemType reflect.Type) {
+	buffer.WriteByte('[')
+	for index, node := range nodes {
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+		writeJSONValue(buffer, node, itemType)
+	}
+	buffer.WriteByte(']')
+}
+
+// writeJSONString writes the text as a JSON string
+func writeJSONString(buffer *bytes.Buffer, text string) {
+	payload, _ := json.Marshal(text)
+	buffer.Write(payload)
+}
+
+// structFields gives the type of the JSON properties of a struct, by their name
+func structFields(structType reflect.Type) func(name string) reflect.Type {
+	fields := map[string]reflect.Type{}
+	collectStructFields(structType, fields)
+	return func(name string) reflect.Type { return fields[name] }
+}
+
+// collectStructFields collects the JSON properties of a struct, including the ones of its embedded structs
+func collectStructFields(structType reflect.Type, fields map[string]reflect.Type) {
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && len(tag) == 0 && indirectType(field.Type).Kind() == reflect.Struct {
+			collectStructFields(indirectType(field.Type), fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(tag) == 0 {
+			tag = field.Name
+		}
+		if _, found := fields[tag]; !found {
+			fields[tag] = field.Type
+		}
+	}
+}
+
+// eventFields gives the type of the JSON properties of a chat event, including the ones of its participant
+func eventFields(eventType reflect.Type) func(name string) reflect.Type {
+	fields := map[string]reflect.Type{}
+	collectStructFields(indirectType(eventType), fields)
+	collectStructFields(participantType, fields)
+	return func(name string) reflect.Type { return fields[name] }
+}
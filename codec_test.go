@@ -0,0 +1,293 @@
+package iwt_test
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanMarshalXML(t *testing.T) {
+	codec := iwt.XMLCodec{}
+	assert.Equal(t, "application/xml", codec.ContentType())
+
+	type payload struct {
+		Name       string            `json:"name"`
+		Type       iwt.QueueType     `json:"queueType"`
+		Count      int               `json:"count"`
+		Enabled    bool              `json:"enabled"`
+		Tags       []string          `json:"tags"`
+		Attributes map[string]string `json:"attributes"`
+		Status     *iwt.Status       `json:"status,omitempty"`
+	}
+	expected := payload{
+		Name:       "Sales & Support",
+		Type:       iwt.UserQueue,
+		Count:      3,
+		Enabled:    true,
+		Tags:       []string{"vip", "fr"},
+		Attributes: map[string]string{"order ID": "1234", "language": "fr"},
+	}
+	data, err := codec.Marshal(expected)
+	require.Nil(t, err, "Failed to marshal, Error: %s", err)
+	assert.Contains(t, string(data), "<iwt>")
+	assert.Contains(t, string(data), "<name>Sales &amp; Support</name>")
+	assert.Contains(t, string(data), "<queueType>User</queueType>")
+	assert.Contains(t, string(data), "<tags>vip</tags><tags>fr</tags>")
+	assert.Contains(t, string(data), `<entry key="order ID">1234</entry>`)
+	assert.NotContains(t, string(data), "<status>", "null values should not be marshaled")
+
+	actual := payload{}
+	err = codec.Unmarshal(data, &actual)
+	require.Nil(t, err, "Failed to unmarshal, Error: %s", err)
+	assert.Equal(t, expected, actual)
+
+	single := payload{}
+	err = codec.Unmarshal([]byte("<iwt><tags>only</tags><count></count></iwt>"), &single)
+	require.Nil(t, err, "Failed to unmarshal, Error: %s", err)
+	assert.Equal(t, []string{"only"}, single.Tags, "A single element should be unmarshaled as an array of one item")
+	assert.Equal(t, 0, single.Count)
+}
+
+func TestCanUnmarshalXMLStatus(t *testing.T) {
+	payload := `<?xml version="1.0" encoding="UTF-8"?>
+<iwt>
+  <chat>
+    <status>
+      <type>failure</type>
+      <reason>error.websvc.unavailable</reason>
+    </status>
+  </chat>
+</iwt>`
+	results := struct {
+		Chat struct {
+			Status iwt.Status `json:"status"`
+		} `json:"chat"`
+	}{}
+	err := iwt.XMLCodec{}.Unmarshal([]byte(payload), &results)
+	require.Nil(t, err, "Failed to unmarshal, Error: %s", err)
+	assert.ErrorIs(t, results.Chat.Status.AsError(), iwt.StatusUnavailableService)
+}
+
+func TestCanDetectXMLServer(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{RetryPolicy: &iwt.NoRetry})
+	server.DisableJSON = true
+
+	chat, serverChat := startTestChat(t, server, client, iwt.StartChatOptions{
+		Guest:      iwt.Participant{ID: "U001", Name: "John Doe"},
+		Attributes: map[string]string{"order ID": "1234"},
+	})
+	assert.Equal(t, "1234", serverChat.Attributes["order ID"])
+
+	requests := server.RequestsTo("/serverConfiguration")
+	require.Len(t, requests, 2, "The refused request should be sent again in XML")
+	assert.Equal(t, "application/json", requests[0].Header.Get("Accept"))
+	assert.Equal(t, "application/xml", requests[1].Header.Get("Accept"))
+
+	requests = server.RequestsTo("/chat/start")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "application/xml", requests[len(requests)-1].Header.Get("Content-Type"))
+
+	agent := serverChat.AddAgent("Bob Minion")
+	agent.Type(true)
+	agent.SendText("banana")
+	agent.SendURL("https://www.genesys.com")
+	agent.SendFile("minion.txt", "text/plain", []byte("Bello!"))
+
+	joined, ok := waitForEvent(t, chat, "participantStateChanged").(*iwt.ParticipantStateChangedEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, agent.ID, joined.Participant.ID)
+	assert.Equal(t, "active", joined.Participant.State)
+
+	typing, ok := waitForEvent(t, chat, "typingIndicator").(*iwt.TypingIndicatorEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.True(t, typing.Typing)
+
+	text, ok := waitForEvent(t, chat, "text").(*iwt.TextEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "banana", text.Text)
+	assert.Equal(t, "Bob Minion", text.Participant.Name)
+
+	link, ok := waitForEvent(t, chat, "url").(*iwt.URLEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "https://www.genesys.com", link.URL.String())
+
+	file, ok := waitForEvent(t, chat, "file").(*iwt.FileEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	content, err := chat.GetFile(context.Background(), file.Path)
+	require.Nil(t, err, "Failed to download file, Error: %s", err)
+	assert.Equal(t, "Bello!", string(content.Data))
+
+	require.Nil(t, chat.SendText(context.Background(), "Hello <World>"))
+	messages := serverChat.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Hello <World>", messages[0].Text)
+	requests = server.RequestsTo("/chat/sendMessage/")
+	require.Len(t, requests, 1)
+	assert.Equal(t, xml.Header+"<iwt><message>Hello &lt;World&gt;</message><contentType>text/plain</contentType></iwt>", string(requests[0].Body))
+
+	for _, request := range server.RequestsTo("/chat/poll/") {
+		assert.True(t, strings.Contains(request.Header.Get("Accept"), "xml"), "Polls should expect XML")
+	}
+}
+
+func TestCanUseXMLCodec(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{Codec: iwt.XMLCodec{}})
+
+	config, err := client.GetServerConfiguration(context.Background())
+	require.Nil(t, err, "Failed to fetch server configuration, Error: %s", err)
+	assert.Contains(t, config.Capabilities["chat"], "sendMessage")
+
+	_, err = client.QueryQueue(context.Background(), "Unknown", iwt.WorkgroupQueue)
+	assert.ErrorIs(t, err, iwt.StatusUnknownEntityQueue)
+
+	for _, request := range server.RequestsTo("/") {
+		assert.False(t, strings.Contains(request.Header.Get("Content-Type"), "json"), "%s should not be sent in JSON", request.Path)
+		assert.True(t, strings.Contains(request.Header.Get("Accept"), "xml"), "%s should expect XML", request.Path)
+	}
+}
+
+func TestCanCheckHealthOfXMLServers(t *testing.T) {
+	primary := iwttest.NewServer()
+	defer primary.Close()
+	primary.DisableJSON = true
+	backup := iwttest.NewBackupServer(primary)
+	defer backup.Close()
+	backup.DisableJSON = true
+	client := newTestClient(t, context.Background(), primary, iwt.ClientOptions{BackupAPI: backup.APIURL(), HealthCheckInterval: -1})
+
+	err := client.CheckHealth(context.Background())
+	require.Nil(t, err, "Failed to check the health, Error: %s", err)
+	health := client.Health()
+	require.Len(t, health, 2)
+	for _, endpoint := range health {
+		assert.True(t, endpoint.Healthy, "%s should be healthy, Error: %s", endpoint.Endpoint, endpoint.Error)
+	}
+	assert.Equal(t, primary.APIURL().String(), client.CurrentAPIEndpoint().String())
+}
+
+func TestShouldSwitchToXMLWhenJSONIsRefused(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.FailHTTP("/serverConfiguration", http.StatusUnsupportedMediaType, 1)
+	_, _ = client.GetServerConfiguration(context.Background())
+	_, err := client.QueryQueue(context.Background(), "Unknown", iwt.WorkgroupQueue)
+	assert.ErrorIs(t, err, iwt.StatusUnknownEntityQueue)
+
+	requests := server.RequestsTo("/queue/query")
+	require.NotEmpty(t, requests)
+	assert.Equal(t, "application/xml", requests[0].Header.Get("Content-Type"), "The client should switch to XML once the server refused JSON")
+}
+
+// newXMLFixtureClient creates a Client for a server that answers with the XML documents of testdata, by request path (without /websvcs)
+//
+// So the XMLCodec is checked against these documents rather than against the fake server, which shares its mapping.
+func newXMLFixtureClient(t *testing.T, fixtures map[string]string) *iwt.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/websvcs")
+		for prefix, filename := range fixtures {
+			if strings.HasPrefix(path, prefix) {
+				data, err := os.ReadFile(filepath.Join(".", "testdata", filename))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				_, _ = w.Write(data)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	api, _ := url.Parse(server.URL + "/websvcs")
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:  api,
+		Codec:       iwt.XMLCodec{},
+		RetryPolicy: &iwt.NoRetry,
+		Logger:      logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+	return client
+}
+
+func TestCanDecodeXMLFixtures(t *testing.T) {
+	client := newXMLFixtureClient(t, map[string]string{
+		"/serverConfiguration": "xml-server-configuration.xml",
+		"/queue/query":         "xml-queue-query.xml",
+		"/chat/start":          "xml-chat-start.xml",
+		"/chat/poll/":          "xml-chat-poll.xml",
+		"/chat/exit/":          "xml-chat-unknown-session.xml",
+	})
+
+	config, err := client.GetServerConfiguration(context.Background())
+	require.Nil(t, err, "Failed to fetch server configuration, Error: %s", err)
+	assert.Equal(t, 1, config.Version)
+	assert.Equal(t, 1000, config.MaxMessageLength)
+	assert.Equal(t, []string{"text/plain", "text/html", "text/uri-list"}, config.ContentTypes())
+	assert.True(t, config.HasCapability("chat", "sendMessage"))
+
+	queue, err := client.QueryQueue(context.Background(), "Sales", iwt.WorkgroupQueue)
+	require.Nil(t, err, "Failed to query the queue, Error: %s", err)
+	assert.Equal(t, 2, queue.AvailableAgents)
+	assert.Equal(t, 30, queue.EstimatedWaitTime)
+	assert.Equal(t, 2000, queue.PollWaitSuggestion)
+
+	chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{Name: "John Doe"},
+	})
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	assert.Equal(t, "f8c4a6e1-5d2b-4c1e-9f3a-7b6d2e8a4c10", chat.ID)
+	assert.Equal(t, "M/d/yyyy", chat.DateFormat)
+
+	joined, ok := waitForEvent(t, chat, "participantStateChanged").(*iwt.ParticipantStateChangedEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "4cf50a4c-73bb-4e24-a6ff-d069dfcc6ceb", joined.Participant.ID)
+	assert.Equal(t, "Administrator", joined.Participant.Name)
+	assert.Equal(t, "active", joined.Participant.State)
+
+	text, ok := waitForEvent(t, chat, "text").(*iwt.TextEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "banana & apples", text.Text)
+	assert.Equal(t, "text/plain", text.ContentType)
+	assert.Equal(t, 2, text.SequenceNumber)
+
+	link, ok := waitForEvent(t, chat, "url").(*iwt.URLEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "https://www.genesys.com", link.URL.String())
+
+	file, ok := waitForEvent(t, chat, "file").(*iwt.FileEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.Equal(t, "/websvcs/chat/getfile/4173f183-ed9d-4b0c-8a19-4899676ab206/46da9750794c465581c043128ad5e28c/-image.jpeg", file.Path)
+
+	typing, ok := waitForEvent(t, chat, "typingIndicator").(*iwt.TypingIndicatorEvent)
+	require.True(t, ok, "Event is not of the proper type")
+	assert.True(t, typing.Typing)
+
+	err = chat.Stop(context.Background())
+	assert.Nil(t, err, "A chat unknown to the server should stop, Error: %s", err)
+}
+
+func TestCanUnmarshalXMLStatusAttributes(t *testing.T) {
+	payload, err := os.ReadFile(filepath.Join(".", "testdata", "xml-chat-unknown-session.xml"))
+	require.Nil(t, err, "Failed to load the fixture, Error: %s", err)
+	results := struct {
+		Chat struct {
+			Status iwt.Status `json:"status"`
+		} `json:"chat"`
+	}{}
+	err = iwt.XMLCodec{}.Unmarshal(payload, &results)
+	require.Nil(t, err, "Failed to unmarshal, Error: %s", err)
+	assert.ErrorIs(t, results.Chat.Status.AsError(), iwt.StatusUnknownEntitySession)
+}
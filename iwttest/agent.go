@@ -0,0 +1,53 @@
+package iwttest
+
+// Agent is a scriptable PureConnect agent participating in a chat
+type Agent struct {
+	ID      string
+	Name    string
+	picture string
+	chat    *Chat
+}
+
+// SetPicture sets the URL of the picture of the agent, as given by /partyInfo
+func (agent *Agent) SetPicture(picture string) {
+	agent.chat.mutex.Lock()
+	defer agent.chat.mutex.Unlock()
+	agent.picture = picture
+}
+
+// Type makes the agent start or stop typing
+func (agent *Agent) Type(typing bool) {
+	agent.chat.newEvent("typingIndicator", agent.ID, agent.Name, "Agent", map[string]interface{}{"value": typing})
+}
+
+// SendText makes the agent send a text message
+func (agent *Agent) SendText(text string) {
+	agent.chat.newEvent("text", agent.ID, agent.Name, "Agent", map[string]interface{}{
+		"conversationSequenceNumber": 0,
+		"contentType":                "text/plain",
+		"value":                      text,
+	})
+}
+
+// SendURL makes the agent send a URL
+func (agent *Agent) SendURL(url string) {
+	agent.chat.newEvent("url", agent.ID, agent.Name, "Agent", map[string]interface{}{"value": url})
+}
+
+// SendFile makes the agent send a file
+//
+// The file can be downloaded by the client from the path given in the event
+func (agent *Agent) SendFile(name, contentType string, data []byte) string {
+	path := agent.chat.addFile(File{Name: name, ContentType: contentType, Data: data})
+	agent.chat.newEvent("file", agent.ID, agent.Name, "Agent", map[string]interface{}{
+		"conversationSequenceNumber": 0,
+		"contentType":                contentType,
+		"value":                      path,
+	})
+	return path
+}
+
+// Disconnect makes the agent leave the chat
+func (agent *Agent) Disconnect() {
+	agent.chat.newEvent("participantStateChanged", agent.ID, agent.Name, "Agent", map[string]interface{}{"state": "disconnected"})
+}
@@ -0,0 +1,226 @@
+package iwttest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Callback describes a callback request on the fake server
+type Callback struct {
+	ID                string
+	ParticipantID     string
+	GuestName         string
+	Queue             string
+	Telephone         string
+	Subject           string
+	Attributes        map[string]string
+	mutex             sync.Mutex
+	agentID           string
+	agentName         string
+	state             string
+	queuePosition     int
+	queueWaitTime     int
+	estimatedCallback int
+	disconnected      bool
+	reconnects        int
+}
+
+// AssignAgent assigns an agent to the callback
+func (callback *Callback) AssignAgent(name string) {
+	callback.mutex.Lock()
+	defer callback.mutex.Unlock()
+	callback.agentID = uuid.NewString()
+	callback.agentName = name
+	callback.state = "alerting"
+}
+
+// SetQueue sets the position of the callback in the queue and its wait times, in seconds
+func (callback *Callback) SetQueue(position, waitTime, estimatedCallbackTime int) {
+	callback.mutex.Lock()
+	defer callback.mutex.Unlock()
+	callback.queuePosition = position
+	callback.queueWaitTime = waitTime
+	callback.estimatedCallback = estimatedCallbackTime
+}
+
+// IsDisconnected tells if the web user cancelled the callback
+func (callback *Callback) IsDisconnected() bool {
+	callback.mutex.Lock()
+	defer callback.mutex.Unlock()
+	return callback.disconnected
+}
+
+// Reconnects tells how many times the client reconnected this callback
+func (callback *Callback) Reconnects() int {
+	callback.mutex.Lock()
+	defer callback.mutex.Unlock()
+	return callback.reconnects
+}
+
+// Callbacks gives all the callbacks created on this server
+func (server *Server) Callbacks() []*Callback {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	callbacks := make([]*Callback, 0, len(server.callbacks))
+	for _, callback := range server.callbacks {
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks
+}
+
+// Callback gives the callback with the given ID, or nil
+func (server *Server) Callback(id string) *Callback {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.callbacks[id]
+}
+
+func (server *Server) callbackByParticipant(participantID string) *Callback {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for _, callback := range server.callbacks {
+		if callback.ParticipantID == participantID {
+			return callback
+		}
+	}
+	return nil
+}
+
+func (server *Server) callbackCreateHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Target      string `json:"target"`
+		TargetType  string `json:"targettype"`
+		Telephone   string `json:"telephone"`
+		Subject     string `json:"subject"`
+		Participant struct {
+			Name        string `json:"participantName"`
+			Credentials string `json:"credentials"`
+		} `json:"participant"`
+		Attributes map[string]string `json:"attributes"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	if _, found := server.queues[queueKey(payload.Target, payload.TargetType)]; !found {
+		server.mutex.Unlock()
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusUnknownQueue}})
+		return
+	}
+	guestName, authenticated := server.authenticate(payload.Participant.Name, payload.Participant.Credentials)
+	if !authenticated {
+		server.mutex.Unlock()
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusInvalidCredentials}})
+		return
+	}
+	callback := &Callback{
+		ID:            uuid.NewString(),
+		ParticipantID: uuid.NewString(),
+		GuestName:     guestName,
+		Queue:         payload.Target,
+		Telephone:     payload.Telephone,
+		Subject:       payload.Subject,
+		Attributes:    payload.Attributes,
+		state:         "queued",
+	}
+	server.callbacks[callback.ID] = callback
+	server.mutex.Unlock()
+
+	writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{
+		"callbackID":    callback.ID,
+		"participantID": callback.ParticipantID,
+		"cfgVer":        server.ConfigurationVersion,
+		"status":        StatusSuccess,
+	}})
+}
+
+func (server *Server) callbackStatusHandler(w http.ResponseWriter, r *http.Request) {
+	callback := server.callbackByParticipant(r.PathValue("participantID"))
+	if callback == nil || callback.IsDisconnected() {
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	callback.mutex.Lock()
+	defer callback.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{
+		"assignedAgentName":          callback.agentName,
+		"assignedAgentParticipantID": callback.agentID,
+		"interactionState":           callback.state,
+		"queuePosition":              callback.queuePosition,
+		"queueWaitTime":              callback.queueWaitTime,
+		"estimatedCallbackTime":      callback.estimatedCallback,
+		"longestWaitTime":            callback.queueWaitTime,
+		"cfgVer":                     server.ConfigurationVersion,
+		"status":                     StatusSuccess,
+	}})
+}
+
+func (server *Server) callbackModifyHandler(w http.ResponseWriter, r *http.Request) {
+	callback := server.callbackByParticipant(r.PathValue("participantID"))
+	if callback == nil || callback.IsDisconnected() {
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	payload := struct {
+		Telephone string `json:"telephone"`
+		Subject   string `json:"subject"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	callback.mutex.Lock()
+	if len(payload.Telephone) > 0 {
+		callback.Telephone = payload.Telephone
+	}
+	if len(payload.Subject) > 0 {
+		callback.Subject = payload.Subject
+	}
+	callback.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{
+		"cfgVer": server.ConfigurationVersion,
+		"status": StatusSuccess,
+	}})
+}
+
+func (server *Server) callbackDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	callback := server.callbackByParticipant(r.PathValue("participantID"))
+	if callback == nil || callback.IsDisconnected() {
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	callback.mutex.Lock()
+	callback.disconnected = true
+	callback.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{
+		"cfgVer": server.ConfigurationVersion,
+		"status": StatusSuccess,
+	}})
+}
+
+func (server *Server) callbackReconnectHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		ID string `json:"callbackID"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	callback := server.Callback(payload.ID)
+	if callback == nil || callback.IsDisconnected() {
+		writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	callback.mutex.Lock()
+	callback.reconnects++
+	callback.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"callback": map[string]interface{}{
+		"callbackID":    callback.ID,
+		"participantID": callback.ParticipantID,
+		"cfgVer":        server.ConfigurationVersion,
+		"status":        StatusSuccess,
+	}})
+}
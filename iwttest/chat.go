@@ -0,0 +1,159 @@
+package iwttest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Chat describes a chat session on the fake server
+type Chat struct {
+	ID           string
+	WebUserID    string
+	GuestName    string
+	Queue        string
+	Language     string
+	Attributes   map[string]string
+	ContentTypes []string // the content types the client supports, given when starting the chat
+	server       *Server
+	mutex        sync.Mutex
+	sequence     int
+	events       []map[string]interface{}
+	delivered    int // how many events were already sent to the client
+	messages     []Message
+	agents       map[string]*Agent
+	files        map[string]File
+	uploads      []File // the files the web user sent
+	typing       bool
+	exited       bool
+	reconnects   int
+}
+
+// Message describes a message sent by the web user
+type Message struct {
+	Text        string `json:"message"`
+	ContentType string `json:"contentType"`
+}
+
+// File describes a file sent by an agent or by the web user
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Messages gives the messages the web user sent so far
+func (chat *Chat) Messages() []Message {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return append([]Message{}, chat.messages...)
+}
+
+// Uploads gives the files the web user sent so far
+func (chat *Chat) Uploads() []File {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return append([]File{}, chat.uploads...)
+}
+
+// IsTyping tells if the web user is typing, as last told by the client
+func (chat *Chat) IsTyping() bool {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return chat.typing
+}
+
+// IsExited tells if the web user left the chat
+func (chat *Chat) IsExited() bool {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return chat.exited
+}
+
+// Reconnects tells how many times the client reconnected this chat
+func (chat *Chat) Reconnects() int {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return chat.reconnects
+}
+
+// AddAgent makes a new agent join the chat
+func (chat *Chat) AddAgent(name string) *Agent {
+	agent := &Agent{
+		ID:   uuid.NewString(),
+		Name: name,
+		chat: chat,
+	}
+	chat.mutex.Lock()
+	chat.agents[agent.ID] = agent
+	chat.mutex.Unlock()
+	chat.newEvent("participantStateChanged", agent.ID, agent.Name, "Agent", map[string]interface{}{"state": "active"})
+	return agent
+}
+
+// SequenceNumber gives the sequence number of the next event
+func (chat *Chat) SequenceNumber() int {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	return chat.sequence
+}
+
+// Push pushes a raw event into the next poll response
+//
+// The sequenceNumber is added if the event does not have one.
+// A given sequenceNumber can be used to push events out of order or to make gaps,
+// the next events are numbered after the highest sequenceNumber.
+func (chat *Chat) Push(event map[string]interface{}) {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if sequenceNumber, found := event["sequenceNumber"]; !found {
+		event["sequenceNumber"] = chat.sequence
+		chat.sequence++
+	} else if sequenceNumber, ok := sequenceNumber.(int); ok && sequenceNumber >= chat.sequence {
+		chat.sequence = sequenceNumber + 1
+	}
+	chat.events = append(chat.events, event)
+}
+
+// newEvent creates a new event and queues it for the next poll
+func (chat *Chat) newEvent(eventType, participantID, participantName, participantType string, values map[string]interface{}) map[string]interface{} {
+	event := map[string]interface{}{
+		"type":            eventType,
+		"participantID":   participantID,
+		"participantName": participantName,
+		"displayName":     participantName,
+		"participantType": participantType,
+	}
+	for key, value := range values {
+		event[key] = value
+	}
+	chat.Push(event)
+	return event
+}
+
+// pendingEvents gives the events not yet sent to the client
+func (chat *Chat) pendingEvents() []map[string]interface{} {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	events := append([]map[string]interface{}{}, chat.events[chat.delivered:]...)
+	chat.delivered = len(chat.events)
+	return events
+}
+
+// allEvents gives all the events of the chat since its start
+func (chat *Chat) allEvents() []map[string]interface{} {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	chat.delivered = len(chat.events)
+	return append([]map[string]interface{}{}, chat.events...)
+}
+
+// addFile stores a file and gives its download path
+func (chat *Chat) addFile(file File) string {
+	id := uuid.NewString()
+	chat.mutex.Lock()
+	chat.files[id] = file
+	chat.mutex.Unlock()
+	return fmt.Sprintf("/websvcs/chat/getfile/%s/%s/%s", chat.WebUserID, id, file.Name)
+}
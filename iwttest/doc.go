@@ -0,0 +1,16 @@
+/*
+Package iwttest provides an in-process fake PureConnect IWT server for testing.
+
+Example:
+
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{PrimaryAPI: server.APIURL()})
+	chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{Queue: iwt.NewQueue("Workgroup Queue:Sales")})
+
+	agent := server.WaitForChat(time.Second).AddAgent("Bob")
+	agent.SendText("Hello!") // will be in the next poll response
+*/
+package iwttest
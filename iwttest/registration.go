@@ -0,0 +1,86 @@
+package iwttest
+
+import (
+	"net/http"
+)
+
+// User describes a web user registered on the fake server
+type User struct {
+	Login    string
+	Password string
+	Name     string
+	Contact  map[string]string
+}
+
+// AddUser registers a web user on the fake server
+func (server *Server) AddUser(login, password, name string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.users[login] = &User{Login: login, Password: password, Name: name, Contact: map[string]string{}}
+}
+
+// User gives the registered web user with the given login, or nil
+func (server *Server) User(login string) *User {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.users[login]
+}
+
+// authenticate gives the name of the web user with the given credentials
+//
+// Participants without credentials are anonymous, their name is kept.
+// The caller must hold the server mutex.
+func (server *Server) authenticate(name, credentials string) (string, bool) {
+	if len(credentials) == 0 {
+		return name, true
+	}
+	user, found := server.users[name]
+	if !found || user.Password != credentials {
+		return "", false
+	}
+	return user.Name, true
+}
+
+func (server *Server) registrationNewHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Name     string            `json:"name"`
+		Login    string            `json:"userID"`
+		Password string            `json:"password"`
+		Contact  map[string]string `json:"contactInfo"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if _, found := server.users[payload.Login]; found {
+		writeResponse(w, r, map[string]interface{}{"registration": map[string]interface{}{"status": StatusDuplicateLogin}})
+		return
+	}
+	server.users[payload.Login] = &User{Login: payload.Login, Password: payload.Password, Name: payload.Name, Contact: payload.Contact}
+	writeResponse(w, r, map[string]interface{}{"registration": map[string]interface{}{"status": StatusSuccess}})
+}
+
+func (server *Server) registrationLoginHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Login    string `json:"userID"`
+		Password string `json:"password"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	user, found := server.users[payload.Login]
+	if !found || user.Password != payload.Password {
+		writeResponse(w, r, map[string]interface{}{"registration": map[string]interface{}{"status": StatusInvalidCredentials}})
+		return
+	}
+	writeResponse(w, r, map[string]interface{}{"registration": map[string]interface{}{
+		"name":        user.Name,
+		"contactInfo": user.Contact,
+		"status":      StatusSuccess,
+	}})
+}
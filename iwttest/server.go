@@ -0,0 +1,798 @@
+package iwttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Server is an in-process fake PureConnect IWT server
+//
+// It serves the /websvcs endpoints used by the go-iwt client over httptest,
+// records every request it receives and lets tests script agents that join
+// chats, type, send text, urls and files, and disconnect.
+// It also serves the callback requests.
+type Server struct {
+	*httptest.Server
+	ConfigurationVersion int
+	Capabilities         map[string][]string
+	PollWaitSuggestion   int // in ms
+	DateFormat           string
+	TimeFormat           string
+	MaxMessageLength     int  // 0 means no limit
+	DisableJSON          bool // like the PureConnect servers that only speak XML, JSON requests get HTTP 415
+	DisableRanges        bool // like the PureConnect servers that ignore the Range header, files are always sent whole
+	mutex                sync.Mutex
+	queues               map[string]*Queue
+	chats                map[string]*Chat // indexed by chat ID
+	participants         map[string]*Chat // indexed by web user participant ID
+	callbacks            map[string]*Callback
+	users                map[string]*User // registered web users, indexed by login
+	requests             []Request
+	faults               []*fault
+	peer                 *Server       // the other server of a switchover pair
+	startedChats         []*Chat       // chats started but not yet given by WaitForChat
+	chatStarted          chan struct{} // notified when a chat is added to startedChats
+	requestRecorded      chan struct{} // closed, then replaced, when a request is recorded
+}
+
+// Queue describes a queue known to the fake server
+type Queue struct {
+	Name              string
+	Type              string
+	AvailableAgents   int
+	EstimatedWaitTime int
+}
+
+// Request describes a request received by the fake server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Status describes the status returned in IWT responses
+type Status struct {
+	Type   string                 `json:"type"`
+	Reason string                 `json:"reason,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+var (
+	// StatusSuccess is returned when a request succeeded
+	StatusSuccess = Status{Type: "success"}
+	// StatusUnknownSession is returned when the chat or participant is not known
+	StatusUnknownSession = Status{Type: "failure", Reason: "error.websvc.unknownEntity.session"}
+	// StatusUnknownQueue is returned when the queue is not known
+	StatusUnknownQueue = Status{Type: "failure", Reason: "error.websvc.unknownEntity.invalidQueue"}
+	// StatusContentTooLong is returned when a message is longer than the MaxMessageLength of the server
+	StatusContentTooLong = Status{Type: "failure", Reason: "error.websvc.content.invalid.tooLong"}
+	// StatusUnavailable is returned when the server cannot serve requests (e.g.: during a switchover)
+	StatusUnavailable = Status{Type: "failure", Reason: "error.websvc.unavailable"}
+	// StatusDuplicateLogin is returned when a web user registers with a login that is already used
+	StatusDuplicateLogin = Status{Type: "failure", Reason: "error.websvc.registration.duplicateUserID"}
+	// StatusInvalidCredentials is returned when the login or the password of a web user is wrong
+	StatusInvalidCredentials = Status{Type: "failure", Reason: "error.websvc.authentication.invalidCredentials"}
+)
+
+// fault describes a failure to inject in the responses of the fake server
+type fault struct {
+	path       string
+	status     Status
+	statusCode int
+	delay      time.Duration // answers normally after the delay
+	times      int
+}
+
+// NewServer starts a new fake IWT server over HTTP
+//
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	server := newServer()
+	server.Server = httptest.NewServer(server.routes())
+	return server
+}
+
+// NewTLSServer starts a new fake IWT server over HTTPS
+//
+// The certificate of the server is available via Certificate() or CACert().
+// The caller should call Close when finished, to shut it down.
+func NewTLSServer() *Server {
+	server := newServer()
+	server.Server = httptest.NewTLSServer(server.routes())
+	return server
+}
+
+// NewUnstartedServer creates a new fake IWT server but does not start it
+//
+// After changing its configuration (e.g.: TLS), the caller should call Start or StartTLS.
+// The caller should call Close when finished, to shut it down.
+func NewUnstartedServer() *Server {
+	server := newServer()
+	server.Server = httptest.NewUnstartedServer(server.routes())
+	return server
+}
+
+// NewBackupServer starts a new fake IWT server over HTTP that is the backup of the given primary server
+//
+// Like a PureConnect switchover pair, both servers share their chats:
+// a chat started on one server can be reconnected and polled on the other.
+// The caller should call Close when finished, to shut it down.
+func NewBackupServer(primary *Server) *Server {
+	server := NewServer()
+	server.peer = primary
+	primary.mutex.Lock()
+	primary.peer = server
+	primary.mutex.Unlock()
+	return server
+}
+
+func newServer() *Server {
+	return &Server{
+		ConfigurationVersion: 1,
+		Capabilities: map[string][]string{
+			"chat":         {"start", "reconnect", "poll", "sendMessage", "setTypingState", "exit", "partyInfo"},
+			"queueQuery":   {"query"},
+			"contentTypes": {"text/plain"},
+			"callback":     {"create", "status", "modify", "disconnect", "reconnect"},
+		},
+		PollWaitSuggestion: 1000,
+		DateFormat:         "M/d/yyyy",
+		TimeFormat:         "h:mm:ss tt",
+		queues:             map[string]*Queue{},
+		chats:              map[string]*Chat{},
+		participants:       map[string]*Chat{},
+		callbacks:          map[string]*Callback{},
+		users:              map[string]*User{},
+		requests:           []Request{},
+		chatStarted:        make(chan struct{}, 1),
+		requestRecorded:    make(chan struct{}),
+	}
+}
+
+// CACert gives the PEM encoded certificate of a TLS server, to use as the client CACert option
+func (server *Server) CACert() []byte {
+	if server.Certificate() == nil {
+		return nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+// APIURL gives the URL the go-iwt client should use as its PrimaryAPI or BackupAPI
+func (server *Server) APIURL() *url.URL {
+	apiURL, _ := url.Parse(server.URL + "/websvcs")
+	return apiURL
+}
+
+// AddQueue adds a queue to the fake server
+//
+// queueType is one of "Workgroup", "User", "Station"
+func (server *Server) AddQueue(name, queueType string, availableAgents, estimatedWaitTime int) *Queue {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	queue := &Queue{Name: name, Type: queueType, AvailableAgents: availableAgents, EstimatedWaitTime: estimatedWaitTime}
+	server.queues[queueKey(name, queueType)] = queue
+	return queue
+}
+
+// Requests gives all the requests received so far
+func (server *Server) Requests() []Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Request{}, server.requests...)
+}
+
+// SetPollWaitSuggestion changes the pollWaitSuggestion (in ms) sent in the next responses
+func (server *Server) SetPollWaitSuggestion(milliseconds int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.PollWaitSuggestion = milliseconds
+}
+
+// pollWaitSuggestion gives the pollWaitSuggestion (in ms) to send in a response
+func (server *Server) pollWaitSuggestion() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.PollWaitSuggestion
+}
+
+// RequestsTo gives the requests received so far whose path starts with the given path (without /websvcs)
+func (server *Server) RequestsTo(path string) []Request {
+	requests := []Request{}
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request.Path, "/websvcs"+path) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// WaitForRequests waits until the server received count requests whose path starts with the given path (without /websvcs)
+//
+// returns false if they were not received before the timeout
+func (server *Server) WaitForRequests(path string, count int, timeout time.Duration) bool {
+	expired := time.After(timeout)
+	for {
+		server.mutex.Lock()
+		recorded := server.requestRecorded
+		server.mutex.Unlock()
+		if len(server.RequestsTo(path)) >= count {
+			return true
+		}
+		select {
+		case <-recorded:
+		case <-expired:
+			return false
+		}
+	}
+}
+
+// Chats gives all the chats started on this server
+func (server *Server) Chats() []*Chat {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	chats := make([]*Chat, 0, len(server.chats))
+	for _, chat := range server.chats {
+		chats = append(chats, chat)
+	}
+	return chats
+}
+
+// Chat gives the chat with the given ID, or nil
+//
+// The chats of the other server of a switchover pair are also searched.
+func (server *Server) Chat(id string) *Chat {
+	server.mutex.Lock()
+	chat, peer := server.chats[id], server.peer
+	server.mutex.Unlock()
+	if chat == nil && peer != nil {
+		peer.mutex.Lock()
+		defer peer.mutex.Unlock()
+		return peer.chats[id]
+	}
+	return chat
+}
+
+// WaitForChat waits for the next chat to be started on this server
+//
+// returns nil if no chat was started before the timeout
+func (server *Server) WaitForChat(timeout time.Duration) *Chat {
+	expired := time.After(timeout)
+	for {
+		server.mutex.Lock()
+		if len(server.startedChats) > 0 {
+			chat := server.startedChats[0]
+			server.startedChats = server.startedChats[1:]
+			server.mutex.Unlock()
+			return chat
+		}
+		server.mutex.Unlock()
+		select {
+		case <-server.chatStarted:
+		case <-expired:
+			return nil
+		}
+	}
+}
+
+// Fail makes the next requests to the given path (without /websvcs) fail with the given status
+//
+// The status is returned in the response (e.g.: {"chat":{"status":...}}) with an HTTP 200.
+// times is the number of requests that will fail, 0 or less means forever (until ClearFailures).
+func (server *Server) Fail(path string, status Status, times int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = append(server.faults, &fault{path: path, status: status, times: times})
+}
+
+// FailHTTP makes the next requests to the given path (without /websvcs) fail with the given HTTP status code
+//
+// times is the number of requests that will fail, 0 or less means forever (until ClearFailures).
+func (server *Server) FailHTTP(path string, statusCode int, times int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = append(server.faults, &fault{path: path, statusCode: statusCode, times: times})
+}
+
+// Delay makes the next requests to the given path (without /websvcs) wait for the given delay before they are answered normally
+//
+// times is the number of requests that will wait, 0 or less means forever (until ClearFailures).
+func (server *Server) Delay(path string, delay time.Duration, times int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = append(server.faults, &fault{path: path, delay: delay, times: times})
+}
+
+// ClearFailures removes all the failures given to Fail, FailHTTP and Delay
+func (server *Server) ClearFailures() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = nil
+}
+
+// Unmarshal decodes the JSON or XML body of a recorded request
+func (request Request) Unmarshal(v interface{}) error {
+	if isXML(request.Header.Get("Content-Type")) {
+		return unmarshalXML(request.Body, v)
+	}
+	return json.Unmarshal(request.Body, v)
+}
+
+func (server *Server) routes() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /websvcs/serverConfiguration", server.serverConfigurationHandler)
+	router.HandleFunc("POST /websvcs/queue/query", server.queueQueryHandler)
+	router.HandleFunc("POST /websvcs/chat/start", server.chatStartHandler)
+	router.HandleFunc("GET /websvcs/chat/poll/{participantID}", server.chatPollHandler)
+	router.HandleFunc("POST /websvcs/chat/poll/{participantID}", server.chatPollHandler)
+	router.HandleFunc("POST /websvcs/chat/sendMessage/{participantID}", server.chatSendMessageHandler)
+	router.HandleFunc("POST /websvcs/chat/sendFile/{participantID}", server.chatSendFileHandler)
+	router.HandleFunc("POST /websvcs/chat/setTypingState/{participantID}", server.chatSetTypingStateHandler)
+	router.HandleFunc("POST /websvcs/chat/exit/{participantID}", server.chatExitHandler)
+	router.HandleFunc("POST /websvcs/chat/reconnect", server.chatReconnectHandler)
+	router.HandleFunc("GET /websvcs/chat/getfile/{participantID}/{fileID}/{filename}", server.chatGetFileHandler)
+	router.HandleFunc("POST /websvcs/partyInfo/{participantID}", server.partyInfoHandler)
+	router.HandleFunc("POST /websvcs/callback/create", server.callbackCreateHandler)
+	router.HandleFunc("POST /websvcs/callback/status/{participantID}", server.callbackStatusHandler)
+	router.HandleFunc("POST /websvcs/callback/modify/{participantID}", server.callbackModifyHandler)
+	router.HandleFunc("POST /websvcs/callback/disconnect/{participantID}", server.callbackDisconnectHandler)
+	router.HandleFunc("POST /websvcs/callback/reconnect", server.callbackReconnectHandler)
+	router.HandleFunc("POST /websvcs/registration/new", server.registrationNewHandler)
+	router.HandleFunc("POST /websvcs/registration/login", server.registrationLoginHandler)
+	return server.recorder(router)
+}
+
+func (server *Server) recorder(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		server.mutex.Lock()
+		server.requests = append(server.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		close(server.requestRecorded)
+		server.requestRecorded = make(chan struct{})
+		fault := server.nextFault(strings.TrimPrefix(r.URL.Path, "/websvcs"))
+		disableJSON := server.DisableJSON
+		server.mutex.Unlock()
+		if disableJSON && wantsJSON(r) {
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+		if fault != nil && fault.delay > 0 {
+			time.Sleep(fault.delay)
+		} else if fault != nil {
+			fault.write(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// nextFault finds the fault to inject for the given path and consumes it
+//
+// The caller must hold the server mutex.
+func (server *Server) nextFault(path string) *fault {
+	for index, fault := range server.faults {
+		if !strings.HasPrefix(path, fault.path) {
+			continue
+		}
+		if fault.times > 0 {
+			fault.times--
+			if fault.times == 0 {
+				server.faults = append(server.faults[:index], server.faults[index+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+func (fault *fault) write(w http.ResponseWriter, r *http.Request) {
+	if fault.statusCode != 0 {
+		http.Error(w, http.StatusText(fault.statusCode), fault.statusCode)
+		return
+	}
+	// The root of the IWT response is the first segment of the path: chat, queue, callback, partyInfo
+	root := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/websvcs"), "/"), "/", 2)[0]
+	response := map[string]interface{}{
+		root: map[string]interface{}{"status": fault.status},
+	}
+	if root == "serverConfiguration" {
+		writeResponse(w, r, []map[string]interface{}{response})
+		return
+	}
+	writeResponse(w, r, response)
+}
+
+func (server *Server) serverConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	configuration := map[string]interface{}{
+		"cfgVer":       server.ConfigurationVersion,
+		"capabilities": server.Capabilities,
+	}
+	if server.MaxMessageLength > 0 {
+		configuration["maxMessageLength"] = server.MaxMessageLength
+	}
+	writeResponse(w, r, []map[string]interface{}{
+		{"serverConfiguration": configuration},
+	})
+}
+
+func (server *Server) queueQueryHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Name string `json:"queueName"`
+		Type string `json:"queueType"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	queue, found := server.queues[queueKey(payload.Name, payload.Type)]
+	if !found {
+		writeResponse(w, r, map[string]interface{}{"queue": map[string]interface{}{"status": StatusUnknownQueue}})
+		return
+	}
+	writeResponse(w, r, map[string]interface{}{"queue": map[string]interface{}{
+		"agentsAvailable":    queue.AvailableAgents,
+		"estimatedWaitTime":  queue.EstimatedWaitTime,
+		"pollWaitSuggestion": server.PollWaitSuggestion,
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatStartHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Target      string `json:"target"`
+		TargetType  string `json:"targettype"`
+		Participant struct {
+			Name        string `json:"participantName"`
+			Credentials string `json:"credentials"`
+		} `json:"participant"`
+		Language              string            `json:"language"`
+		Attributes            map[string]string `json:"attributes"`
+		SupportedContentTypes string            `json:"supportedContentTypes"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	if _, found := server.queues[queueKey(payload.Target, payload.TargetType)]; !found {
+		server.mutex.Unlock()
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownQueue}})
+		return
+	}
+	guestName, authenticated := server.authenticate(payload.Participant.Name, payload.Participant.Credentials)
+	if !authenticated {
+		server.mutex.Unlock()
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusInvalidCredentials}})
+		return
+	}
+	chat := &Chat{
+		ID:         uuid.NewString(),
+		WebUserID:  uuid.NewString(),
+		GuestName:  guestName,
+		Queue:      payload.Target,
+		Language:   payload.Language,
+		Attributes: payload.Attributes,
+		server:     server,
+		agents:     map[string]*Agent{},
+		files:      map[string]File{},
+	}
+	for _, contentType := range strings.Split(payload.SupportedContentTypes, ",") {
+		if contentType = strings.TrimSpace(contentType); len(contentType) > 0 {
+			chat.ContentTypes = append(chat.ContentTypes, contentType)
+		}
+	}
+	server.chats[chat.ID] = chat
+	server.participants[chat.WebUserID] = chat
+	server.mutex.Unlock()
+
+	events := []map[string]interface{}{
+		chat.newEvent("participantStateChanged", chat.WebUserID, chat.GuestName, "WebUser", map[string]interface{}{"state": "active"}),
+	}
+	chat.mutex.Lock()
+	chat.delivered = len(chat.events)
+	chat.mutex.Unlock()
+	server.mutex.Lock()
+	server.startedChats = append(server.startedChats, chat)
+	server.mutex.Unlock()
+	select {
+	case server.chatStarted <- struct{}{}:
+	default: // WaitForChat was already notified
+	}
+
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"chatID":             chat.ID,
+		"participantID":      chat.WebUserID,
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"dateFormat":         server.DateFormat,
+		"timeFormat":         server.TimeFormat,
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             events,
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatPollHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             chat.pendingEvents(),
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatSendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	message := Message{}
+	if err := decodeRequest(r, &message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	maxMessageLength := server.MaxMessageLength
+	server.mutex.Unlock()
+	if maxMessageLength > 0 && len([]rune(message.Text)) > maxMessageLength {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusContentTooLong}})
+		return
+	}
+	chat.mutex.Lock()
+	chat.messages = append(chat.messages, message)
+	chat.mutex.Unlock()
+	// PureConnect echoes the messages of the web user in the chat events
+	chat.newEvent("text", chat.WebUserID, chat.GuestName, "WebUser", map[string]interface{}{
+		"conversationSequenceNumber": 0,
+		"contentType":                message.ContentType,
+		"value":                      message.Text,
+	})
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             chat.pendingEvents(),
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatSendFileHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	part, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer part.Close()
+	data, err := io.ReadAll(part)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file := File{Name: header.Filename, ContentType: header.Header.Get("Content-Type"), Data: data}
+	path := chat.addFile(file)
+	chat.mutex.Lock()
+	chat.uploads = append(chat.uploads, file)
+	chat.mutex.Unlock()
+	// PureConnect echoes the files of the web user in the chat events
+	chat.newEvent("file", chat.WebUserID, chat.GuestName, "WebUser", map[string]interface{}{
+		"conversationSequenceNumber": 0,
+		"contentType":                file.ContentType,
+		"value":                      path,
+	})
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             chat.pendingEvents(),
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatSetTypingStateHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	payload := struct {
+		Typing bool `json:"typingIndicator"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chat.mutex.Lock()
+	chat.typing = payload.Typing
+	chat.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             chat.pendingEvents(),
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatExitHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	chat.newEvent("participantStateChanged", chat.WebUserID, chat.GuestName, "WebUser", map[string]interface{}{"state": "disconnected"})
+	chat.mutex.Lock()
+	chat.exited = true
+	chat.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"cfgVer": server.ConfigurationVersion,
+		"events": chat.pendingEvents(),
+		"status": StatusSuccess,
+	}})
+}
+
+func (server *Server) chatReconnectHandler(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		ChatID string `json:"chatID"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chat := server.Chat(payload.ChatID)
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	chat.mutex.Lock()
+	chat.reconnects++
+	chat.mutex.Unlock()
+	// PureConnect replays all the events of the chat on reconnect
+	writeResponse(w, r, map[string]interface{}{"chat": map[string]interface{}{
+		"participantID":      chat.WebUserID,
+		"pollWaitSuggestion": server.pollWaitSuggestion(),
+		"cfgVer":             server.ConfigurationVersion,
+		"events":             chat.allEvents(),
+		"status":             StatusSuccess,
+	}})
+}
+
+func (server *Server) chatGetFileHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil {
+		http.NotFound(w, r)
+		return
+	}
+	chat.mutex.Lock()
+	file, found := chat.files[r.PathValue("fileID")]
+	chat.mutex.Unlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	server.mutex.Lock()
+	disableRanges := server.DisableRanges
+	server.mutex.Unlock()
+	if disableRanges {
+		r.Header.Del("Range")
+	}
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
+	http.ServeContent(w, r, file.Name, time.Time{}, bytes.NewReader(file.Data))
+}
+
+func (server *Server) partyInfoHandler(w http.ResponseWriter, r *http.Request) {
+	chat := server.chatByParticipant(r.PathValue("participantID"))
+	if chat == nil || chat.IsExited() {
+		writeResponse(w, r, map[string]interface{}{"partyInfo": map[string]interface{}{"status": StatusUnknownSession}})
+		return
+	}
+	payload := struct {
+		ParticipantID string `json:"participantID"`
+	}{}
+	if err := decodeRequest(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chat.mutex.Lock()
+	agent, found := chat.agents[payload.ParticipantID]
+	if !found {
+		chat.mutex.Unlock()
+		writeResponse(w, r, map[string]interface{}{"partyInfo": map[string]interface{}{"status": Status{Type: "failure", Reason: "error.websvc.unknownEntity.participant"}}})
+		return
+	}
+	info := map[string]interface{}{
+		"name":   agent.Name,
+		"status": StatusSuccess,
+	}
+	if len(agent.picture) > 0 {
+		info["photo"] = agent.picture
+	}
+	chat.mutex.Unlock()
+	writeResponse(w, r, map[string]interface{}{"partyInfo": info})
+}
+
+func (server *Server) chatByParticipant(participantID string) *Chat {
+	server.mutex.Lock()
+	chat, peer := server.participants[participantID], server.peer
+	server.mutex.Unlock()
+	if chat == nil && peer != nil {
+		peer.mutex.Lock()
+		defer peer.mutex.Unlock()
+		return peer.participants[participantID]
+	}
+	return chat
+}
+
+func queueKey(name, queueType string) string {
+	if len(queueType) == 0 {
+		queueType = "Workgroup"
+	}
+	return strings.ToLower(queueType) + ":" + name
+}
+
+// isXML tells if the MIME type (or list of them as in Accept) is XML
+func isXML(mimeType string) bool {
+	return strings.Contains(mimeType, "xml")
+}
+
+// wantsJSON tells if the request is sent in JSON or expects JSON
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(r.Header.Get("Content-Type"), "json") || (strings.Contains(accept, "json") && !isXML(accept))
+}
+
+// decodeRequest decodes the JSON or XML body of the request
+func decodeRequest(r *http.Request, payload interface{}) error {
+	if isXML(r.Header.Get("Content-Type")) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return unmarshalXML(body, payload)
+	}
+	return json.NewDecoder(r.Body).Decode(payload)
+}
+
+// writeResponse writes the payload in XML if the request is in XML or expects XML, in JSON otherwise
+func writeResponse(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	if isXML(r.Header.Get("Content-Type")) || isXML(r.Header.Get("Accept")) {
+		body, err := marshalXML(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,289 @@
+package iwttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Server writes its XML documents itself, so a bug in the client's XMLCodec cannot hide behind the same bug in the Server.
+//
+// The documents follow the mapping of iwt.XMLCodec, which is derived from the JSON documents, not from a PureConnect server:
+// their root element is <iwt>, each JSON property is an element with the same name,
+// the items of an array are repeated elements, the items of a top-level array are <item> elements,
+// and the properties whose name is not a valid XML name are <entry key="name"> elements.
+// When reading, the attributes of an element are read like child elements with the same name.
+
+// marshalXML encodes the payload as an XML document
+func marshalXML(payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBufferString(xml.Header)
+	buffer.WriteString("<iwt>")
+	if err = writeXMLValue(buffer, value, "item"); err != nil {
+		return nil, err
+	}
+	buffer.WriteString("</iwt>")
+	return buffer.Bytes(), nil
+}
+
+// writeXMLValue writes the value as the content of the current element
+func writeXMLValue(buffer *bytes.Buffer, value interface{}, itemName string) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXMLElement(buffer, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXMLElement(buffer, itemName, item); err != nil {
+				return err
+			}
+		}
+	case string:
+		return xml.EscapeText(buffer, []byte(value))
+	case json.Number:
+		buffer.WriteString(value.String())
+	case bool:
+		buffer.WriteString(strconv.FormatBool(value))
+	}
+	return nil
+}
+
+// writeXMLElement writes the value as an element with the given name, arrays as repeated elements
+func writeXMLElement(buffer *bytes.Buffer, name string, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXMLElement(buffer, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	start, end := "<"+name+">", "</"+name+">"
+	if !isXMLName(name) {
+		key := &bytes.Buffer{}
+		if err := xml.EscapeText(key, []byte(name)); err != nil {
+			return err
+		}
+		start, end = `<entry key="`+key.String()+`">`, "</entry>"
+	}
+	buffer.WriteString(start)
+	if err := writeXMLValue(buffer, value, "item"); err != nil {
+		return err
+	}
+	buffer.WriteString(end)
+	return nil
+}
+
+// isXMLName tells if the name can be used as an element name
+func isXMLName(name string) bool {
+	if len(name) == 0 || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for index, r := range name {
+		switch {
+		case r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z'):
+		case index > 0 && (r == '-' || r == '.' || ('0' <= r && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// xmlElement is an element of an XML document
+type xmlElement struct {
+	name     string // the key attribute of <entry> elements
+	text     string
+	children []*xmlElement // the attributes, then the child elements
+}
+
+// unmarshalXML decodes the XML document into v
+//
+// As XML has no types, the values are converted according to the JSON tags of v.
+func unmarshalXML(data []byte, v interface{}) error {
+	root, err := readXMLElement(xml.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+	valueType := reflect.TypeOf(v)
+	if valueType == nil || valueType.Kind() != reflect.Ptr {
+		return fmt.Errorf("cannot unmarshal XML into %T", v)
+	}
+	var value interface{}
+	if elementType := indirect(valueType.Elem()); elementType.Kind() == reflect.Slice {
+		value = xmlItems(root.children, elementType.Elem())
+	} else {
+		value = xmlValue(root, elementType)
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// readXMLElement reads the root element of the document
+func readXMLElement(decoder *xml.Decoder) (*xmlElement, error) {
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no XML element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: token.Name.Local}
+			for _, attribute := range token.Attr {
+				switch {
+				case len(attribute.Name.Space) > 0 || attribute.Name.Local == "xmlns":
+					// namespace declarations and qualified attributes are not part of the values
+				case token.Name.Local == "entry" && attribute.Name.Local == "key":
+					element.name = attribute.Value
+				default:
+					element.children = append(element.children, &xmlElement{name: attribute.Name.Local, text: attribute.Value})
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			}
+			stack = append(stack, element)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(token)
+			}
+		case xml.EndElement:
+			element := stack[len(stack)-1]
+			if stack = stack[:len(stack)-1]; len(stack) == 0 {
+				return element, nil
+			}
+		}
+	}
+}
+
+// indirect gives the type pointed to by the given type
+func indirect(valueType reflect.Type) reflect.Type {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	return valueType
+}
+
+// xmlValue converts the element to a value that encodes in JSON as the given type
+func xmlValue(element *xmlElement, valueType reflect.Type) interface{} {
+	valueType = indirect(valueType)
+	if reflect.PtrTo(valueType).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) && len(element.children) == 0 {
+		return element.text
+	}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		value := map[string]interface{}{}
+		xmlFields(element, valueType, value)
+		return value
+	case reflect.Map:
+		value := map[string]interface{}{}
+		for _, child := range element.children {
+			value[child.name] = xmlValue(child, valueType.Elem())
+		}
+		return value
+	case reflect.Slice:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			return element.text
+		}
+		return xmlItems(element.children, valueType.Elem())
+	case reflect.Bool:
+		if value, err := strconv.ParseBool(strings.TrimSpace(element.text)); err == nil {
+			return value
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if text := strings.TrimSpace(element.text); len(text) > 0 {
+			return json.Number(text)
+		}
+		return nil
+	case reflect.Interface:
+		if len(element.children) == 0 {
+			return element.text
+		}
+		value := map[string]interface{}{}
+		for _, child := range element.children {
+			value[child.name] = xmlValue(child, valueType)
+		}
+		return value
+	}
+	return element.text
+}
+
+// xmlFields converts the children of the element to the fields of the struct type
+func xmlFields(element *xmlElement, structType reflect.Type, value map[string]interface{}) {
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if name = strings.Split(tag, ",")[0]; name == "-" {
+				continue
+			}
+		}
+		if field.Anonymous && len(field.Tag.Get("json")) == 0 && indirect(field.Type).Kind() == reflect.Struct {
+			xmlFields(element, indirect(field.Type), value)
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		children := []*xmlElement{}
+		for _, child := range element.children {
+			if child.name == name {
+				children = append(children, child)
+			}
+		}
+		fieldType := indirect(field.Type)
+		switch {
+		case len(children) == 0:
+		case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() != reflect.Uint8:
+			value[name] = xmlItems(children, fieldType.Elem())
+		default:
+			value[name] = xmlValue(children[0], fieldType)
+		}
+	}
+}
+
+// xmlItems converts the elements to the items of an array
+func xmlItems(elements []*xmlElement, itemType reflect.Type) []interface{} {
+	items := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		items = append(items, xmlValue(element, itemType))
+	}
+	return items
+}
@@ -0,0 +1,76 @@
+package iwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gildas/go-errors"
+	"golang.org/x/text/language"
+)
+
+// DefaultLanguage is the last language tried when negotiating the language of a chat
+const DefaultLanguage = "en-US"
+
+// parseLanguages parses a BCP-47 language tag (e.g. "fr-CA") or a list of them as in Accept-Language (e.g. "fr-CA, fr;q=0.9, en;q=0.5")
+//
+// The tags are given by order of preference.
+func parseLanguages(value string) ([]language.Tag, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return []language.Tag{}, nil
+	}
+	tags, _, err := language.ParseAcceptLanguage(value)
+	if err != nil || len(tags) == 0 {
+		return nil, errors.ArgumentInvalid.With("language", value)
+	}
+	return tags, nil
+}
+
+// negotiateLanguage gives the best language among the ones the server supports for the wanted languages
+//
+// The wanted languages are tried in order, with their parents (e.g. fr-CA, then fr), then DefaultLanguage.
+// If none matches, the first language of the server is used.
+// If the server does not advertise its languages, the first wanted language is used.
+func negotiateLanguage(wanted []language.Tag, supported []string) language.Tag {
+	wanted = append(append([]language.Tag{}, wanted...), language.MustParse(DefaultLanguage))
+	tags := make([]language.Tag, 0, len(supported))
+	for _, value := range supported {
+		if tag, err := language.Parse(value); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return wanted[0]
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(wanted...)
+	if confidence == language.No {
+		return tags[0]
+	}
+	return tags[index]
+}
+
+// negotiateLanguage gives the language to use with the server for the wanted language (as given to StartChat, etc)
+//
+// The Client Language is tried after the wanted language.
+// If the wanted language is not a valid BCP-47 language tag (or list of them), an error is returned.
+func (client *Client) negotiateLanguage(ctx context.Context, wanted string) (string, error) {
+	tags, err := parseLanguages(wanted)
+	if err != nil {
+		return "", err
+	}
+	if clientTags, err := parseLanguages(client.Language); err == nil {
+		tags = append(tags, clientTags...)
+	}
+	supported := []string{}
+	if config, err := client.serverConfiguration(ctx); err == nil {
+		supported = config.Languages()
+	}
+	return negotiateLanguage(tags, supported).String(), nil
+}
+
+// acceptLanguage gives the Accept-Language to send with the requests that do not belong to a chat or a callback
+func (client *Client) acceptLanguage() string {
+	if _, err := parseLanguages(client.Language); err != nil {
+		return ""
+	}
+	return client.Language
+}
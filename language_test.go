@@ -0,0 +1,55 @@
+package iwt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanNegotiateLanguage(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.Capabilities["languages"] = []string{"en-US", "fr", "ja"}
+
+	chat, _ := startTestChat(t, server, client, iwt.StartChatOptions{Language: "fr-CA"})
+	assert.Equal(t, "fr", chat.Language)
+	assert.Equal(t, "fr", server.Chat(chat.ID).Language)
+	requests := server.RequestsTo("/chat/start")
+	require.NotEmpty(t, requests)
+	assert.Equal(t, "fr", requests[len(requests)-1].Header.Get("Accept-Language"))
+
+	require.Nil(t, chat.SendText(context.Background(), "Bonjour"))
+	requests = server.RequestsTo("/chat/sendMessage")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "fr", requests[0].Header.Get("Accept-Language"))
+
+	chat, _ = startTestChat(t, server, newTestClient(t, context.Background(), server, iwt.ClientOptions{Language: "ja-JP"}), iwt.StartChatOptions{})
+	assert.Equal(t, "ja", chat.Language, "The Client language should be used when the chat has none")
+
+	chat, _ = startTestChat(t, server, client, iwt.StartChatOptions{Language: "pt-BR, de;q=0.8"})
+	assert.Equal(t, "en-US", chat.Language, "The default language should be used when nothing matches")
+}
+
+func TestShouldKeepLanguageWhenServerDoesNotAdvertiseAny(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	chat, _ := startTestChat(t, server, newTestClient(t, context.Background(), server, iwt.ClientOptions{Language: "ja-JP"}), iwt.StartChatOptions{Language: "fr-CA"})
+	assert.Equal(t, "fr-CA", chat.Language)
+
+	chat, _ = startTestChat(t, server, client, iwt.StartChatOptions{})
+	assert.Equal(t, iwt.DefaultLanguage, chat.Language)
+}
+
+func TestFailsStartChatWithInvalidLanguage(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	_, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:    iwt.NewQueue("Workgroup Queue:Sales"),
+		Language: "not a language!",
+	})
+	assert.ErrorIs(t, err, errors.ArgumentInvalid)
+	assert.Empty(t, server.RequestsTo("/chat/start"), "The chat should not reach the server")
+}
@@ -0,0 +1,62 @@
+package iwt
+
+import (
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// Metrics receives the measurements of a Client, its chats and their requests
+//
+// The methods are called from several goroutines, implementations must be safe for concurrent use.
+// See PrometheusMetrics for an implementation that can be scraped by Prometheus.
+type Metrics interface {
+	// ObserveRequest is called after each attempt of a request to PureConnect
+	//
+	// operation is the IWT endpoint (e.g. "chat/poll"), reason is "success", the Status reason, or the error ID.
+	ObserveRequest(operation, reason string, duration time.Duration)
+	// ChatStarted is called when a chat is started or resumed
+	ChatStarted()
+	// ChatEnded is called when a chat is stopped, by the web user or PureConnect
+	ChatEnded()
+	// EventReceived is called for each event PureConnect sends to a chat (e.g. "text")
+	EventReceived(eventType string)
+	// PollFailed is called when polling the messages of a chat failed
+	PollFailed(reason string)
+	// Reconnected is called after a chat was reconnected, reason is "success" or why it failed
+	Reconnected(reason string)
+	// SwitchedOver is called when the Client switches to another API endpoint
+	SwitchedOver()
+	// ObserveAgentWait is called when the first agent joins a chat, with the time since the chat was started
+	ObserveAgentWait(wait time.Duration)
+}
+
+// noMetrics is the Metrics of a Client, if none is given in the ClientOptions
+type noMetrics struct{}
+
+func (noMetrics) ObserveRequest(operation, reason string, duration time.Duration) {}
+func (noMetrics) ChatStarted()                                                    {}
+func (noMetrics) ChatEnded()                                                      {}
+func (noMetrics) EventReceived(eventType string)                                  {}
+func (noMetrics) PollFailed(reason string)                                        {}
+func (noMetrics) Reconnected(reason string)                                       {}
+func (noMetrics) SwitchedOver()                                                   {}
+func (noMetrics) ObserveAgentWait(wait time.Duration)                             {}
+
+// metricReason gives the reason of an outcome, as given to Metrics
+//
+// i.e.: "success", the Status reason, the error ID, or "error".
+func metricReason(err error) string {
+	if err == nil {
+		return "success"
+	}
+	var status Status
+	if errors.As(err, &status) && len(status.Reason) > 0 {
+		return status.Reason
+	}
+	var details *errors.Error
+	if errors.As(err, &details) && len(details.ID) > 0 {
+		return details.ID
+	}
+	return "error"
+}
@@ -0,0 +1,282 @@
+package iwt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRequestBuckets are the buckets (in seconds) of the request durations of PrometheusMetrics
+var DefaultRequestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultAgentWaitBuckets are the buckets (in seconds) of the wait times until the first agent of PrometheusMetrics
+var DefaultAgentWaitBuckets = []float64{5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// PrometheusMetrics is a Metrics that exposes its measurements in the Prometheus text format
+//
+// It is an http.Handler to be scraped by Prometheus, e.g.:
+//
+//	metrics := iwt.NewPrometheusMetrics("iwt")
+//	client, err := iwt.NewClient(ctx, iwt.ClientOptions{Metrics: metrics})
+//	http.Handle("/metrics", metrics)
+//
+// It exposes (with the namespace as prefix):
+//
+//	requests_total{operation, reason}                   counter
+//	request_duration_seconds{operation, reason}         histogram
+//	active_chats                                        gauge
+//	events_received_total{type}                         counter
+//	poll_failures_total{reason}                         counter
+//	reconnects_total{reason}                            counter
+//	switchovers_total                                   counter
+//	agent_wait_seconds                                  histogram
+type PrometheusMetrics struct {
+	Namespace        string
+	RequestBuckets   []float64
+	AgentWaitBuckets []float64
+	requests         map[requestLabels]*histogram
+	activeChats      int64
+	events           map[string]uint64
+	pollFailures     map[string]uint64
+	reconnects       map[string]uint64
+	switchovers      uint64
+	agentWait        *histogram
+	mutex            sync.Mutex
+}
+
+// requestLabels are the labels of the request metrics
+type requestLabels struct {
+	operation string
+	reason    string
+}
+
+// histogram is a Prometheus histogram, counts[i] counts the observations <= buckets[i]
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewPrometheusMetrics instantiates a new PrometheusMetrics
+//
+// The namespace prefixes the name of the metrics (e.g. "iwt" gives "iwt_active_chats").
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		Namespace:        namespace,
+		RequestBuckets:   DefaultRequestBuckets,
+		AgentWaitBuckets: DefaultAgentWaitBuckets,
+		requests:         map[requestLabels]*histogram{},
+		events:           map[string]uint64{},
+		pollFailures:     map[string]uint64{},
+		reconnects:       map[string]uint64{},
+	}
+}
+
+// ObserveRequest counts an attempt of a request and its duration
+func (metrics *PrometheusMetrics) ObserveRequest(operation, reason string, duration time.Duration) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	labels := requestLabels{operation, reason}
+	requests, found := metrics.requests[labels]
+	if !found {
+		requests = newHistogram(metrics.RequestBuckets)
+		metrics.requests[labels] = requests
+	}
+	requests.observe(duration.Seconds())
+}
+
+// ChatStarted counts a live chat
+func (metrics *PrometheusMetrics) ChatStarted() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.activeChats++
+}
+
+// ChatEnded stops counting a live chat
+func (metrics *PrometheusMetrics) ChatEnded() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.activeChats--
+}
+
+// EventReceived counts an event received by a chat
+func (metrics *PrometheusMetrics) EventReceived(eventType string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.events[eventType]++
+}
+
+// PollFailed counts a failed poll
+func (metrics *PrometheusMetrics) PollFailed(reason string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.pollFailures[reason]++
+}
+
+// Reconnected counts a reconnect of a chat
+func (metrics *PrometheusMetrics) Reconnected(reason string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.reconnects[reason]++
+}
+
+// SwitchedOver counts a switchover of a Client
+func (metrics *PrometheusMetrics) SwitchedOver() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.switchovers++
+}
+
+// ObserveAgentWait observes how long a chat waited for its first agent
+func (metrics *PrometheusMetrics) ObserveAgentWait(wait time.Duration) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if metrics.agentWait == nil {
+		metrics.agentWait = newHistogram(metrics.AgentWaitBuckets)
+	}
+	metrics.agentWait.observe(wait.Seconds())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (metrics *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = metrics.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (metrics *PrometheusMetrics) WriteTo(writer io.Writer) (int64, error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	buffer := bufio.NewWriter(writer)
+	output := &countingWriter{writer: buffer}
+	labels := make([]requestLabels, 0, len(metrics.requests))
+	for label := range metrics.requests {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].operation == labels[j].operation {
+			return labels[i].reason < labels[j].reason
+		}
+		return labels[i].operation < labels[j].operation
+	})
+
+	metrics.writeHeader(output, "requests_total", "counter", "Requests sent to PureConnect, by IWT operation and status reason.")
+	for _, label := range labels {
+		output.printf("%s%s %d\n", metrics.name("requests_total"), formatLabels("operation", label.operation, "reason", label.reason), metrics.requests[label].count)
+	}
+	metrics.writeHeader(output, "request_duration_seconds", "histogram", "Duration of the requests sent to PureConnect, by IWT operation and status reason.")
+	for _, label := range labels {
+		metrics.requests[label].write(output, metrics.name("request_duration_seconds"), "operation", label.operation, "reason", label.reason)
+	}
+	metrics.writeHeader(output, "active_chats", "gauge", "Chats that are currently live.")
+	output.printf("%s %d\n", metrics.name("active_chats"), metrics.activeChats)
+	metrics.writeCounters(output, "events_received_total", "Events received from PureConnect, by type.", "type", metrics.events)
+	metrics.writeCounters(output, "poll_failures_total", "Polls of chat messages that failed, by reason.", "reason", metrics.pollFailures)
+	metrics.writeCounters(output, "reconnects_total", "Chat reconnects, by reason.", "reason", metrics.reconnects)
+	metrics.writeHeader(output, "switchovers_total", "counter", "Switchovers to another API endpoint.")
+	output.printf("%s %d\n", metrics.name("switchovers_total"), metrics.switchovers)
+	metrics.writeHeader(output, "agent_wait_seconds", "histogram", "Time chats waited until their first agent joined.")
+	agentWait := metrics.agentWait
+	if agentWait == nil {
+		agentWait = newHistogram(metrics.AgentWaitBuckets)
+	}
+	agentWait.write(output, metrics.name("agent_wait_seconds"))
+
+	if output.err == nil {
+		output.err = buffer.Flush()
+	}
+	return output.count, output.err
+}
+
+// name gives the full name of a metric
+func (metrics *PrometheusMetrics) name(name string) string {
+	if len(metrics.Namespace) == 0 {
+		return name
+	}
+	return metrics.Namespace + "_" + name
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func (metrics *PrometheusMetrics) writeHeader(output *countingWriter, name, metricType, help string) {
+	output.printf("# HELP %s %s\n# TYPE %s %s\n", metrics.name(name), help, metrics.name(name), metricType)
+}
+
+// writeCounters writes a counter with one label
+func (metrics *PrometheusMetrics) writeCounters(output *countingWriter, name, help, label string, counters map[string]uint64) {
+	metrics.writeHeader(output, name, "counter", help)
+	values := make([]string, 0, len(counters))
+	for value := range counters {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		output.printf("%s%s %d\n", metrics.name(name), formatLabels(label, value), counters[value])
+	}
+}
+
+// newHistogram instantiates a new histogram with the given buckets, in seconds
+func newHistogram(buckets []float64) *histogram {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// observe adds a value to the histogram
+func (histogram *histogram) observe(value float64) {
+	for index, bucket := range histogram.buckets {
+		if value <= bucket {
+			histogram.counts[index]++
+		}
+	}
+	histogram.count++
+	histogram.sum += value
+}
+
+// write writes the buckets, sum and count of the histogram with the given labels (as name, value pairs)
+func (histogram *histogram) write(output *countingWriter, name string, labels ...string) {
+	for index, bucket := range histogram.buckets {
+		output.printf("%s_bucket%s %d\n", name, formatLabels(append(labels, "le", strconv.FormatFloat(bucket, 'g', -1, 64))...), histogram.counts[index])
+	}
+	output.printf("%s_bucket%s %d\n", name, formatLabels(append(labels, "le", "+Inf")...), histogram.count)
+	output.printf("%s_sum%s %s\n", name, formatLabels(labels...), strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+	output.printf("%s_count%s %d\n", name, formatLabels(labels...), histogram.count)
+}
+
+// labelEscaper escapes the values of the labels as the Prometheus text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats the labels given as name, value pairs (e.g. {operation="chat/poll",reason="success"})
+func formatLabels(labels ...string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for index := 0; index+1 < len(labels); index += 2 {
+		pairs = append(pairs, labels[index]+`="`+labelEscaper.Replace(labels[index+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// countingWriter writes to a writer, counts the bytes written and keeps the first error
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+	err    error
+}
+
+func (output *countingWriter) printf(format string, args ...interface{}) {
+	if output.err != nil {
+		return
+	}
+	written, err := fmt.Fprintf(output.writer, format, args...)
+	output.count += int64(written)
+	output.err = err
+}
@@ -0,0 +1,92 @@
+package iwt_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, metrics *iwt.PrometheusMetrics) string {
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	return recorder.Body.String()
+}
+
+func TestCanMeasureChats(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	metrics := iwt.NewPrometheusMetrics("iwt")
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:  server.APIURL(),
+		RetryPolicy: &iwt.NoRetry,
+		Metrics:     metrics,
+		Logger:      logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+
+	chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{ID: "U001", Name: "John Doe"},
+	})
+	require.Nil(t, err, "Failed to start the chat, Error: %s", err)
+	assert.Contains(t, scrapeMetrics(t, metrics), "iwt_active_chats 1\n")
+
+	server.Fail("/chat/poll", iwttest.StatusUnavailable, 1)
+	server.Chat(chat.ID).AddAgent("Bob Minion").SendText("banana")
+	timeout := time.After(5 * time.Second)
+	for received := false; !received; {
+		select {
+		case event := <-chat.EventChan:
+			received = event.GetType() == "text"
+		case <-timeout:
+			t.Fatal("Did not receive a text event")
+		}
+	}
+	require.Nil(t, chat.Reconnect(context.Background()))
+	require.Nil(t, chat.Stop(context.Background()))
+
+	scraped := scrapeMetrics(t, metrics)
+	assert.Contains(t, scraped, "# TYPE iwt_requests_total counter\n")
+	assert.Contains(t, scraped, `iwt_requests_total{operation="chat/start",reason="success"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_requests_total{operation="chat/poll",reason="error.websvc.unavailable"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_request_duration_seconds_count{operation="chat/start",reason="success"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_request_duration_seconds_bucket{operation="chat/start",reason="success",le="+Inf"} 1`+"\n")
+	assert.Contains(t, scraped, "iwt_active_chats 0\n")
+	assert.Contains(t, scraped, `iwt_events_received_total{type="participantStateChanged"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_events_received_total{type="text"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_poll_failures_total{reason="error.websvc.unavailable"} 1`+"\n")
+	assert.Contains(t, scraped, `iwt_reconnects_total{reason="success"} 1`+"\n")
+	assert.Contains(t, scraped, "iwt_switchovers_total 0\n")
+	assert.Contains(t, scraped, "iwt_agent_wait_seconds_count 1\n")
+	assert.Contains(t, scraped, `iwt_agent_wait_seconds_bucket{le="5"} 1`+"\n")
+}
+
+func TestCanExposePrometheusMetrics(t *testing.T) {
+	metrics := iwt.NewPrometheusMetrics("")
+	metrics.RequestBuckets = []float64{1, 0.1}
+	metrics.ObserveRequest("queue/query", "success", 50*time.Millisecond)
+	metrics.ObserveRequest("queue/query", "success", 500*time.Millisecond)
+	metrics.ObserveRequest("chat/poll", `error."quoted"`, 2*time.Second)
+	metrics.SwitchedOver()
+
+	scraped := scrapeMetrics(t, metrics)
+	assert.Contains(t, scraped, `requests_total{operation="queue/query",reason="success"} 2`+"\n")
+	assert.Contains(t, scraped, `request_duration_seconds_bucket{operation="queue/query",reason="success",le="0.1"} 1`+"\n")
+	assert.Contains(t, scraped, `request_duration_seconds_bucket{operation="queue/query",reason="success",le="1"} 2`+"\n")
+	assert.Contains(t, scraped, `request_duration_seconds_sum{operation="queue/query",reason="success"} 0.55`+"\n")
+	assert.Contains(t, scraped, `requests_total{operation="chat/poll",reason="error.\"quoted\""} 1`+"\n")
+	assert.Contains(t, scraped, "switchovers_total 1\n")
+	assert.Less(t, strings.Index(scraped, `operation="chat/poll"`), strings.Index(scraped, `operation="queue/query"`), "Metrics should be sorted")
+}
@@ -1,7 +1,9 @@
 package iwt
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"net/url"
 
 	"github.com/gildas/go-core"
@@ -25,23 +27,39 @@ var (
 )
 
 // GetParticipant fetches a participant from a chat by its ID
-func (chat *Chat) GetParticipant(id string) (*Participant, error) {
+func (chat *Chat) GetParticipant(ctx context.Context, id string) (*Participant, error) {
 	log := chat.Logger.Scope("partyinfo")
 
-	if len(chat.ID) == 0 || len(chat.Participants) == 0 || len(chat.Participants[0].ID) == 0 {
+	_, webUser, ok := chat.webUser()
+	if !ok {
 		log.Errorf("chat is not connected")
 		return nil, StatusNotConnectedEntity
 	}
+	return chat.Client.getParticipant(ctx, chat.Language, webUser.ID, id)
+}
+
+// GetParticipant fetches a participant by its ID from the chat of the given web user
+//
+// Unlike Chat.GetParticipant, it does not need a live Chat,
+// e.g. to look at a chat that is run by another process, without reconnecting or polling it.
+func (client *Client) GetParticipant(ctx context.Context, webUserID, id string) (*Participant, error) {
+	if len(webUserID) == 0 {
+		return nil, errors.ArgumentMissing.With("webUserID")
+	}
+	return client.getParticipant(ctx, client.Language, webUserID, id)
+}
 
+// getParticipant sends the partyInfo request of the given web user
+func (client *Client) getParticipant(ctx context.Context, language, webUserID, id string) (*Participant, error) {
 	if id == SystemParticipant.ID {
 		return &SystemParticipant, nil
 	}
 
-	log.Debugf("Requesting party information...")
+	client.Logger.Child("participant", "partyinfo").Debugf("Requesting party information...")
 	results := struct {
 		Participant Participant `json:"partyInfo"`
 	}{}
-	_, err := chat.Client.post("/partyInfo/"+chat.Participants[0].ID,
+	_, err := client.send(ctx, http.MethodPost, "/partyInfo/"+webUserID, language,
 		struct {
 			ParticipantID string `json:"participantID"`
 		}{id}, &results)
@@ -0,0 +1,200 @@
+package iwt
+
+import (
+	"container/heap"
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// DefaultPollWorkers is how many chats a Client polls at the same time, if not given in the ClientOptions
+const DefaultPollWorkers = 16
+
+// pollJitter is the fraction of the poll interval that is randomly added or removed, to spread the polls
+const pollJitter = 0.1
+
+// minPollWaitSuggestion is the shortest poll interval, whatever PureConnect suggests
+const minPollWaitSuggestion = time.Second
+
+// pollScheduler polls the chats of a Client with a bounded pool of workers
+//
+// Each chat is polled at its PollWaitSuggestion, with some jitter.
+// A chat is scheduled again only after its poll completed, so polls of the same chat never overlap.
+type pollScheduler struct {
+	client  *Client
+	workers int
+	queue   pollQueue // the chats waiting for their next poll, the next one first
+	entries map[*Chat]*pollEntry
+	jobs    chan *pollEntry
+	wakeup  chan struct{} // tells the dispatcher the queue changed
+	start   sync.Once
+	mutex   sync.Mutex
+}
+
+// pollEntry is a chat in the pollScheduler
+type pollEntry struct {
+	chat    *Chat
+	ctx     context.Context // canceled when the chat stops polling
+	next    time.Time
+	index   int // in the queue, -1 when the chat is being polled
+	removed bool
+}
+
+// newPollScheduler creates a pollScheduler, its goroutines are started with the first chat
+func newPollScheduler(client *Client, workers int) *pollScheduler {
+	return &pollScheduler{
+		client:  client,
+		workers: workers,
+		queue:   pollQueue{},
+		entries: map[*Chat]*pollEntry{},
+		jobs:    make(chan *pollEntry),
+		wakeup:  make(chan struct{}, 1),
+	}
+}
+
+// schedule adds a chat to the scheduler, its first poll is after its PollWaitSuggestion
+//
+// If the chat was already scheduled, it is replaced.
+func (scheduler *pollScheduler) schedule(ctx context.Context, chat *Chat) {
+	scheduler.start.Do(func() {
+		go scheduler.dispatch(scheduler.client.Context)
+		for worker := 0; worker < scheduler.workers; worker++ {
+			go scheduler.work(scheduler.client.Context)
+		}
+	})
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.remove(chat)
+	entry := &pollEntry{chat: chat, ctx: ctx, next: time.Now().Add(jittered(chat.pollInterval(), pollJitter))}
+	scheduler.entries[chat] = entry
+	heap.Push(&scheduler.queue, entry)
+	scheduler.notify()
+}
+
+// unschedule removes a chat from the scheduler, a poll in progress is not canceled
+func (scheduler *pollScheduler) unschedule(chat *Chat) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.remove(chat)
+}
+
+// remove removes a chat from the scheduler, the caller must hold scheduler.mutex
+func (scheduler *pollScheduler) remove(chat *Chat) {
+	entry, found := scheduler.entries[chat]
+	if !found {
+		return
+	}
+	entry.removed = true
+	delete(scheduler.entries, chat)
+	if entry.index >= 0 {
+		heap.Remove(&scheduler.queue, entry.index)
+	}
+}
+
+// reschedule schedules the next poll of a chat after its poll completed
+func (scheduler *pollScheduler) reschedule(entry *pollEntry) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if entry.removed || entry.ctx.Err() != nil {
+		return
+	}
+	entry.next = time.Now().Add(jittered(entry.chat.pollInterval(), pollJitter))
+	heap.Push(&scheduler.queue, entry)
+	scheduler.notify()
+}
+
+// notify wakes up the dispatcher, the caller must hold scheduler.mutex
+func (scheduler *pollScheduler) notify() {
+	select {
+	case scheduler.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch gives the chats to the workers when their poll is due
+func (scheduler *pollScheduler) dispatch(ctx context.Context) {
+	for {
+		scheduler.mutex.Lock()
+		wait := time.Hour
+		var due *pollEntry
+		if len(scheduler.queue) > 0 {
+			if wait = time.Until(scheduler.queue[0].next); wait <= 0 {
+				due = heap.Pop(&scheduler.queue).(*pollEntry)
+			}
+		}
+		scheduler.mutex.Unlock()
+
+		if due != nil {
+			select {
+			case scheduler.jobs <- due:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-scheduler.wakeup:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// work polls the chats given by the dispatcher
+func (scheduler *pollScheduler) work(ctx context.Context) {
+	for {
+		select {
+		case entry := <-scheduler.jobs:
+			if entry.ctx.Err() != nil {
+				continue
+			}
+			if entry.chat.pollMessages(entry.ctx) {
+				scheduler.reschedule(entry)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// jittered gives the interval with the given fraction of it randomly added or removed
+func jittered(interval time.Duration, jitter float64) time.Duration {
+	spread := int64(float64(interval) * jitter)
+	if spread <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int64N(2*spread+1)-spread)
+}
+
+// pollQueue is a heap of pollEntry, ordered by their next poll
+type pollQueue []*pollEntry
+
+func (queue pollQueue) Len() int           { return len(queue) }
+func (queue pollQueue) Less(i, j int) bool { return queue[i].next.Before(queue[j].next) }
+
+func (queue pollQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+	queue[i].index = i
+	queue[j].index = j
+}
+
+func (queue *pollQueue) Push(item interface{}) {
+	entry := item.(*pollEntry)
+	entry.index = len(*queue)
+	*queue = append(*queue, entry)
+}
+
+func (queue *pollQueue) Pop() interface{} {
+	old := *queue
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*queue = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,117 @@
+package iwt_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanPollChatsWithScheduler(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:  server.APIURL(),
+		PollWorkers: 2,
+		Logger:      logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+
+	chats := []*iwt.Chat{}
+	for _, guestID := range []string{"U001", "U002", "U003", "U004", "U005"} {
+		chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+			Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+			Guest: iwt.Participant{ID: guestID, Name: "Guest " + guestID},
+		})
+		require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+		defer chat.Stop(context.Background())
+		chats = append(chats, chat)
+	}
+
+	webUsers := map[string]string{} // web user participant IDs, indexed by chat ID
+	for _, chat := range server.Chats() {
+		webUsers[chat.ID] = chat.WebUserID
+	}
+	polls := func(chatID string) int {
+		return len(server.RequestsTo("/chat/poll/" + webUsers[chatID]))
+	}
+	time.Sleep(2500 * time.Millisecond)
+	for chatID := range webUsers {
+		assert.GreaterOrEqual(t, polls(chatID), 1, "Chat %s should be polled every second", chatID)
+		assert.LessOrEqual(t, polls(chatID), 3, "Chat %s should be polled every second", chatID)
+	}
+
+	chatID := chats[0].String()
+	server.SetPollWaitSuggestion(3000)
+	time.Sleep(1200 * time.Millisecond) // the next poll gets the new suggestion
+	before := polls(chatID)
+	time.Sleep(2500 * time.Millisecond)
+	assert.LessOrEqual(t, polls(chatID)-before, 1, "The poll interval should follow the server suggestion")
+
+	require.Nil(t, chats[0].Stop(context.Background()))
+	stopped := polls(chatID)
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, stopped, polls(chatID), "A stopped chat should not be polled anymore")
+}
+
+func TestShouldNotBlockPollWorkersOnSlowConsumer(t *testing.T) {
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:  server.APIURL(),
+		PollWorkers: 1,
+		Logger:      logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+
+	slow, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:           iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:           iwt.Participant{ID: "U001", Name: "Slow"},
+		EventBufferSize: 1,
+	})
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	defer slow.Stop(context.Background())
+	fast, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{ID: "U002", Name: "Fast"},
+	})
+	require.Nil(t, err, "Failed to start a chat, Error: %s", err)
+	defer fast.Stop(context.Background())
+
+	slowAgent := server.Chat(slow.ID).AddAgent("Bob Minion")
+	for i := 1; i <= 5; i++ {
+		slowAgent.SendText(fmt.Sprintf("message %d", i))
+	}
+	time.Sleep(1500 * time.Millisecond) // the slow chat is polled and its consumer does not read
+	server.Chat(fast.ID).AddAgent("Kevin Minion").SendText("banana")
+	timeout := time.After(5 * time.Second)
+	for received := false; !received; {
+		select {
+		case event := <-fast.EventChan:
+			received = event.GetType() == "text"
+		case <-timeout:
+			require.FailNow(t, "The slow consumer blocked the poll worker")
+		}
+	}
+
+	texts := []string{}
+	for len(texts) < 5 {
+		select {
+		case event := <-slow.EventChan:
+			if text, ok := event.(*iwt.TextEvent); ok {
+				texts = append(texts, text.Text)
+			}
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "Did not receive all the messages of the slow chat")
+		}
+	}
+	assert.Equal(t, []string{"message 1", "message 2", "message 3", "message 4", "message 5"}, texts, "No event should be dropped or reordered")
+}
@@ -1,7 +1,10 @@
 package iwt
 
 import (
+	"context"
 	"strings"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Queue describe a queue
@@ -40,11 +43,14 @@ func NewQueue(qualifiedqueue string) *Queue {
 }
 
 // QueryQueue queries a queue for its status
-func (client *Client) QueryQueue(queuename string, queuetype QueueType) (*Queue, error) {
+func (client *Client) QueryQueue(ctx context.Context, queuename string, queuetype QueueType) (queue *Queue, err error) {
+	ctx, span := client.startSpan(ctx, "iwt.QueryQueue", trace.WithAttributes(QueueAttribute.String(queuetype.Prefix()+queuename)))
+	defer func() { endSpan(span, err) }()
+
 	results := struct {
 		Queue Queue `json:"queue"`
 	}{}
-	_, err := client.post("/queue/query",
+	_, err = client.post(ctx, "/queue/query",
 		struct {
 			Queue
 			Participant Participant `json:"participant"`
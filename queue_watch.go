@@ -0,0 +1,318 @@
+package iwt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// DefaultQueueWatchInterval is how often a watched queue is queried, if no interval is given to WatchQueue
+const DefaultQueueWatchInterval = 10 * time.Second
+
+// queueEventBufferSize is the size of the channels returned by WatchQueue
+const queueEventBufferSize = 16
+
+// QueueChange tells what changed in a watched queue
+type QueueChange string
+
+const (
+	// AgentsAvailable is used when agents became available in the queue (or are available when the watch starts)
+	AgentsAvailable QueueChange = "agentsAvailable"
+	// AgentsUnavailable is used when no agent is available anymore in the queue (or when the watch starts)
+	AgentsUnavailable QueueChange = "agentsUnavailable"
+	// WaitTimeAbove is used when the estimated wait time went above a threshold (or is above when the watch starts)
+	WaitTimeAbove QueueChange = "waitTimeAbove"
+	// WaitTimeBelow is used when the estimated wait time went back to or below a threshold (or is below when the watch starts)
+	WaitTimeBelow QueueChange = "waitTimeBelow"
+	// QueueQueryFailed is used when the queue could not be queried, the error is in the QueueEvent
+	QueueQueryFailed QueueChange = "queryFailed"
+)
+
+// QueueEvent is sent by WatchQueue when a queue changed
+type QueueEvent struct {
+	Queue     Queue       `json:"queue"` // the queue as last queried
+	Change    QueueChange `json:"change"`
+	Threshold int         `json:"threshold,omitempty"` // the wait time threshold that was crossed, for WaitTimeAbove and WaitTimeBelow
+	Error     error       `json:"-"`                   // why the queue could not be queried, for QueueQueryFailed
+}
+
+// queuePoller queries a queue for all its watchers
+type queuePoller struct {
+	queue    Queue
+	interval time.Duration // the smallest interval of the watchers
+	watchers map[*queueWatcher]struct{}
+	reset    chan struct{} // tells the poller to use its new interval
+	queryNow bool          // tells the poller to query right away when it is reset, for a new watcher
+	cancel   context.CancelFunc
+	mutex    sync.Mutex
+}
+
+// queueWatcher is a caller of WatchQueue
+//
+// Its state is what was last delivered, so a change that was dropped is sent again at the next query.
+type queueWatcher struct {
+	events     chan QueueEvent
+	interval   time.Duration
+	thresholds []int
+	available  *bool        // nil until the availability of the agents was delivered
+	above      map[int]bool // if the wait time is above each threshold, for the thresholds that were delivered
+}
+
+// WatchQueue watches a queue and sends its changes on the returned channel
+//
+// The queue is queried every interval (default: DefaultQueueWatchInterval).
+// When the watch starts, the current state of the queue is sent (AgentsAvailable or AgentsUnavailable,
+// and WaitTimeAbove or WaitTimeBelow for each threshold), then only its changes.
+// waitThresholds are estimated wait times, WaitTimeAbove and WaitTimeBelow are sent when they are crossed.
+//
+// All the watchers of the same queue share the same poller, which queries the queue at the smallest of their intervals.
+// The watch stops and the channel is closed when the given context or the Client context is done.
+// If the caller does not read the channel fast enough, events are dropped, the changes are sent again at the next query.
+func (client *Client) WatchQueue(ctx context.Context, queue *Queue, interval time.Duration, waitThresholds ...int) (<-chan QueueEvent, error) {
+	if queue == nil || len(queue.Name) == 0 {
+		return nil, errors.ArgumentMissing.With("queue")
+	}
+	if interval <= 0 {
+		interval = DefaultQueueWatchInterval
+	}
+	watcher := &queueWatcher{
+		events:     make(chan QueueEvent, queueEventBufferSize),
+		interval:   interval,
+		thresholds: append([]int{}, waitThresholds...),
+		above:      map[int]bool{},
+	}
+
+	client.mutex.Lock()
+	if client.queuePollers == nil {
+		client.queuePollers = map[string]*queuePoller{}
+	}
+	poller, found := client.queuePollers[queue.String()]
+	if !found {
+		pollerCtx, cancel := context.WithCancel(client.Context)
+		poller = &queuePoller{
+			queue:    Queue{Name: queue.Name, Type: queue.Type},
+			interval: interval,
+			watchers: map[*queueWatcher]struct{}{},
+			reset:    make(chan struct{}, 1),
+			cancel:   cancel,
+		}
+		client.queuePollers[queue.String()] = poller
+		go client.pollQueue(pollerCtx, poller)
+	}
+	watchers := poller.addWatcher(watcher)
+	client.mutex.Unlock()
+	client.Logger.Child("queue", "watch").Debugf("Watching queue %s every %s (%d watchers)", queue, interval, watchers)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-client.Context.Done():
+		}
+		client.unwatchQueue(poller, watcher)
+	}()
+	return watcher.events, nil
+}
+
+// unwatchQueue removes a watcher from its poller, the poller is stopped when it has no watchers left
+func (client *Client) unwatchQueue(poller *queuePoller, watcher *queueWatcher) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if poller.removeWatcher(watcher) == 0 {
+		poller.cancel()
+		if client.queuePollers[poller.queue.String()] == poller {
+			delete(client.queuePollers, poller.queue.String())
+		}
+	}
+}
+
+// stopQueuePoller closes the channels of the watchers that are left when a poller stops
+func (client *Client) stopQueuePoller(poller *queuePoller) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	poller.mutex.Lock()
+	watchers := make([]*queueWatcher, 0, len(poller.watchers))
+	for watcher := range poller.watchers {
+		watchers = append(watchers, watcher)
+	}
+	poller.mutex.Unlock()
+	for _, watcher := range watchers {
+		poller.removeWatcher(watcher)
+	}
+	if client.queuePollers[poller.queue.String()] == poller {
+		delete(client.queuePollers, poller.queue.String())
+	}
+}
+
+// pollQueue queries the queue of the poller until it has no watchers left or the Client context is done
+func (client *Client) pollQueue(ctx context.Context, poller *queuePoller) {
+	log := client.Logger.Child("queue", "watch", "queue", poller.queue.String())
+	defer client.stopQueuePoller(poller)
+
+	poller.mutex.Lock()
+	ticker := time.NewTicker(poller.interval)
+	poller.mutex.Unlock()
+	defer ticker.Stop()
+	for {
+		queue, err := client.QueryQueue(ctx, poller.queue.Name, poller.queue.Type)
+		if ctx.Err() != nil {
+			log.Debugf("No more watchers, stopping")
+			return
+		}
+		if err != nil {
+			log.Warnf("Failed to query the queue: %s", err)
+			poller.notify(func(watcher *queueWatcher) []QueueEvent {
+				return []QueueEvent{{Queue: poller.queue, Change: QueueQueryFailed, Error: err}}
+			})
+		} else {
+			poller.notify(func(watcher *queueWatcher) []QueueEvent { return watcher.changes(*queue) })
+		}
+
+		if !poller.wait(ctx, ticker) {
+			log.Debugf("No more watchers, stopping")
+			return
+		}
+	}
+}
+
+// wait waits until the poller must query its queue again, it gives false if the poller must stop
+func (poller *queuePoller) wait(ctx context.Context, ticker *time.Ticker) bool {
+	for {
+		// A reset goes first, so the poller does not query at the interval it had before
+		select {
+		case <-poller.reset:
+			if poller.resetTicker(ticker) {
+				return true
+			}
+			continue
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-poller.reset:
+			if poller.resetTicker(ticker) {
+				return true
+			}
+		case <-ticker.C:
+			return true
+		}
+	}
+}
+
+// resetTicker makes the ticker tick at the interval of the poller and tells if the poller must query right away
+//
+// A tick at the previous interval that was not read yet is dropped.
+func (poller *queuePoller) resetTicker(ticker *time.Ticker) bool {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	ticker.Reset(poller.interval)
+	select {
+	case <-ticker.C:
+	default:
+	}
+	queryNow := poller.queryNow
+	poller.queryNow = false
+	return queryNow
+}
+
+// addWatcher adds a watcher to the poller, adjusts its interval, and gives how many watchers it has
+//
+// If the poller was already running, it queries the queue right away so the new watcher gets its current state.
+func (poller *queuePoller) addWatcher(watcher *queueWatcher) int {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	poller.watchers[watcher] = struct{}{}
+	if watcher.interval < poller.interval {
+		poller.interval = watcher.interval
+	}
+	if len(poller.watchers) > 1 {
+		poller.queryNow = true
+		select {
+		case poller.reset <- struct{}{}:
+		default:
+		}
+	}
+	return len(poller.watchers)
+}
+
+// removeWatcher removes a watcher from the poller, closes its channel, and gives how many watchers are left
+//
+// The interval of the poller becomes the smallest interval of the watchers that are left.
+func (poller *queuePoller) removeWatcher(watcher *queueWatcher) int {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if _, found := poller.watchers[watcher]; !found {
+		return len(poller.watchers)
+	}
+	delete(poller.watchers, watcher)
+	close(watcher.events)
+	if len(poller.watchers) == 0 {
+		return 0
+	}
+	interval := time.Duration(0)
+	for watcher := range poller.watchers {
+		if interval == 0 || watcher.interval < interval {
+			interval = watcher.interval
+		}
+	}
+	if interval != poller.interval {
+		poller.interval = interval
+		select {
+		case poller.reset <- struct{}{}:
+		default:
+		}
+	}
+	return len(poller.watchers)
+}
+
+// notify sends the events computed for each watcher, dropping them if a watcher is not ready
+//
+// Only the delivered changes update the state of a watcher.
+func (poller *queuePoller) notify(events func(watcher *queueWatcher) []QueueEvent) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	for watcher := range poller.watchers {
+		for _, event := range events(watcher) {
+			select {
+			case watcher.events <- event:
+				watcher.delivered(event)
+			default:
+			}
+		}
+	}
+}
+
+// changes gives the events to send to the watcher for the given state of the queue
+func (watcher *queueWatcher) changes(queue Queue) []QueueEvent {
+	events := []QueueEvent{}
+	if available := queue.AvailableAgents > 0; watcher.available == nil || *watcher.available != available {
+		if available {
+			events = append(events, QueueEvent{Queue: queue, Change: AgentsAvailable})
+		} else {
+			events = append(events, QueueEvent{Queue: queue, Change: AgentsUnavailable})
+		}
+	}
+	for _, threshold := range watcher.thresholds {
+		if above, found := watcher.above[threshold]; !found || above != (queue.EstimatedWaitTime > threshold) {
+			if queue.EstimatedWaitTime > threshold {
+				events = append(events, QueueEvent{Queue: queue, Change: WaitTimeAbove, Threshold: threshold})
+			} else {
+				events = append(events, QueueEvent{Queue: queue, Change: WaitTimeBelow, Threshold: threshold})
+			}
+		}
+	}
+	return events
+}
+
+// delivered updates the state of the watcher with a change it received
+func (watcher *queueWatcher) delivered(event QueueEvent) {
+	switch event.Change {
+	case AgentsAvailable, AgentsUnavailable:
+		available := event.Change == AgentsAvailable
+		watcher.available = &available
+	case WaitTimeAbove, WaitTimeBelow:
+		watcher.above[event.Threshold] = event.Change == WaitTimeAbove
+	}
+}
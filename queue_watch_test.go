@@ -0,0 +1,170 @@
+package iwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextQueueEvent(t *testing.T, events <-chan iwt.QueueEvent) iwt.QueueEvent {
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "The queue event channel was closed")
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Timeout while waiting for a queue event")
+	}
+	return iwt.QueueEvent{}
+}
+
+// waitForQueueWatchEnd waits for the channel of a queue watch to be closed, the events still in it are dropped
+func waitForQueueWatchEnd(t *testing.T, events <-chan iwt.QueueEvent) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "The channel should be closed when the watch ends")
+		}
+	}
+}
+
+func TestCanWatchQueue(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.AddQueue("Sales", "Workgroup", 0, 120)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.WatchQueue(ctx, iwt.NewQueue("Workgroup Queue:Sales"), 50*time.Millisecond, 60)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+
+	event := nextQueueEvent(t, events)
+	assert.Equal(t, iwt.AgentsUnavailable, event.Change)
+	assert.Equal(t, "Sales", event.Queue.Name)
+	event = nextQueueEvent(t, events)
+	assert.Equal(t, iwt.WaitTimeAbove, event.Change)
+	assert.Equal(t, 60, event.Threshold)
+
+	server.AddQueue("Sales", "Workgroup", 2, 30)
+	event = nextQueueEvent(t, events)
+	assert.Equal(t, iwt.AgentsAvailable, event.Change)
+	assert.Equal(t, 2, event.Queue.AvailableAgents)
+	event = nextQueueEvent(t, events)
+	assert.Equal(t, iwt.WaitTimeBelow, event.Change)
+
+	server.AddQueue("Sales", "Workgroup", 1, 30)
+	queries := len(server.RequestsTo("/queue/query"))
+	// The poller sends the next query only after the answer of the previous one was given to the watchers
+	require.True(t, server.WaitForRequests("/queue/query", queries+2, 5*time.Second), "The queue should be queried again")
+	select {
+	case event := <-events:
+		assert.Failf(t, "Unexpected event", "The queue did not cross anything, got %s", event.Change)
+	default:
+	}
+
+	cancel()
+	waitForQueueWatchEnd(t, events)
+}
+
+func TestShouldShareQueuePoller(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow, err := client.WatchQueue(ctx, iwt.NewQueue("Workgroup Queue:Sales"), time.Hour)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	assert.Equal(t, iwt.AgentsAvailable, nextQueueEvent(t, slow).Change)
+	fast, err := client.WatchQueue(ctx, iwt.NewQueue("Workgroup Queue:Sales"), 50*time.Millisecond)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	assert.Equal(t, iwt.AgentsAvailable, nextQueueEvent(t, fast).Change)
+
+	// The slow watcher is told at the interval of the fast watcher, as they share the poller
+	server.AddQueue("Sales", "Workgroup", 0, 0)
+	assert.Equal(t, iwt.AgentsUnavailable, nextQueueEvent(t, slow).Change)
+	assert.Equal(t, iwt.AgentsUnavailable, nextQueueEvent(t, fast).Change)
+
+	// Nobody watches the queue anymore while the poller waits for an answer
+	server.Delay("/queue/query", time.Second, 0)
+	queries := len(server.RequestsTo("/queue/query"))
+	require.True(t, server.WaitForRequests("/queue/query", queries+1, 5*time.Second), "The queue should be queried again")
+	queries = len(server.RequestsTo("/queue/query"))
+	cancel()
+	waitForQueueWatchEnd(t, slow)
+	waitForQueueWatchEnd(t, fast)
+	assert.False(t, server.WaitForRequests("/queue/query", queries+1, 500*time.Millisecond), "The poller should stop when no one watches the queue")
+	assert.Len(t, server.RequestsTo("/queue/query"), queries)
+}
+
+func TestShouldReportQueueQueryFailures(t *testing.T) {
+	_, client := newTestFixture(t, iwt.ClientOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.WatchQueue(ctx, iwt.NewQueue("Workgroup Queue:Marketing"), 50*time.Millisecond)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	event := nextQueueEvent(t, events)
+	assert.Equal(t, iwt.QueueQueryFailed, event.Change)
+	assert.ErrorIs(t, event.Error, iwt.StatusUnknownEntityQueue)
+
+	_, err = client.WatchQueue(ctx, nil, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestShouldSendDroppedQueueChangesAgain(t *testing.T) {
+	_, client := newTestFixture(t, iwt.ClientOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	thresholds := []int{}
+	for threshold := 1; threshold <= 20; threshold++ {
+		thresholds = append(thresholds, threshold)
+	}
+	// The first query gives more changes than the channel can hold
+	events, err := client.WatchQueue(ctx, iwt.NewQueue("Workgroup Queue:Sales"), 50*time.Millisecond, thresholds...)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	require.Eventually(t, func() bool { return len(events) == cap(events) }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, iwt.AgentsAvailable, nextQueueEvent(t, events).Change)
+	received := map[int]int{}
+	for len(received) < len(thresholds) {
+		event := nextQueueEvent(t, events)
+		require.Equal(t, iwt.WaitTimeBelow, event.Change)
+		received[event.Threshold]++
+	}
+	for _, threshold := range thresholds {
+		assert.Equal(t, 1, received[threshold], "The change of threshold %d should be received once", threshold)
+	}
+}
+
+func TestShouldSlowDownQueuePollerWhenFastWatcherLeaves(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	slowCtx, slowCancel := context.WithCancel(context.Background())
+	defer slowCancel()
+	fastCtx, fastCancel := context.WithCancel(context.Background())
+	defer fastCancel()
+	slow, err := client.WatchQueue(slowCtx, iwt.NewQueue("Workgroup Queue:Sales"), time.Hour)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	fast, err := client.WatchQueue(fastCtx, iwt.NewQueue("Workgroup Queue:Sales"), 50*time.Millisecond)
+	require.Nil(t, err, "Failed to watch the queue, Error: %s", err)
+	assert.Equal(t, iwt.AgentsAvailable, nextQueueEvent(t, slow).Change)
+	assert.Equal(t, iwt.AgentsAvailable, nextQueueEvent(t, fast).Change)
+
+	// The fast watcher leaves while the poller waits for an answer
+	server.Delay("/queue/query", 500*time.Millisecond, 0)
+	queries := len(server.RequestsTo("/queue/query"))
+	require.True(t, server.WaitForRequests("/queue/query", queries+1, 5*time.Second), "The queue should be queried again")
+	queries = len(server.RequestsTo("/queue/query"))
+	fastCancel()
+	waitForQueueWatchEnd(t, fast)
+	server.ClearFailures()
+	assert.False(t, server.WaitForRequests("/queue/query", queries+1, time.Second), "The queue should be queried at the interval of the watcher that is left")
+	assert.Len(t, server.RequestsTo("/queue/query"), queries)
+}
@@ -0,0 +1,123 @@
+package iwt
+
+import (
+	"context"
+
+	"github.com/gildas/go-errors"
+)
+
+// UserRegistration describes a web user to register on PureConnect
+type UserRegistration struct {
+	Name     string      `json:"name"`
+	Login    string      `json:"userID"`
+	Password string      `json:"password"`
+	Contact  ContactInfo `json:"contactInfo"`
+}
+
+// ContactInfo describes the contact details of a registered web user
+type ContactInfo struct {
+	EmailAddress string `json:"emailAddress,omitempty"`
+	Telephone    string `json:"telephone,omitempty"`
+	MobilePhone  string `json:"mobilePhone,omitempty"`
+	Company      string `json:"company,omitempty"`
+	Address      string `json:"address,omitempty"`
+	City         string `json:"city,omitempty"`
+	PostalCode   string `json:"postalCode,omitempty"`
+	Country      string `json:"country,omitempty"`
+}
+
+// Identity is a web user authenticated by Client.Login or Client.RegisterUser
+//
+// Give it to StartChat or CreateCallback to start them as this web user instead of an anonymous one.
+// PureConnect does not issue tokens, the Identity keeps the credentials to send them with these requests,
+// they are never encoded in JSON.
+type Identity struct {
+	Login       string      `json:"login"`
+	Name        string      `json:"name"`
+	Contact     ContactInfo `json:"contactInfo"`
+	credentials string
+}
+
+type registrationResponse struct {
+	Name    string      `json:"name,omitempty"`
+	Contact ContactInfo `json:"contactInfo,omitempty"`
+	Status  Status      `json:"status"`
+}
+
+// RegisterUser registers a new web user on PureConnect and gives its Identity
+//
+// If the login is already used, an error matching StatusDuplicateLogin is returned.
+func (client *Client) RegisterUser(ctx context.Context, registration UserRegistration) (*Identity, error) {
+	log := client.Logger.Child("registration", "register")
+	if len(registration.Login) == 0 {
+		return nil, errors.ArgumentMissing.With("login")
+	}
+	if len(registration.Password) == 0 {
+		return nil, errors.ArgumentMissing.With("password")
+	}
+
+	log.Debugf("Registering web user %s", registration.Login)
+	results := struct {
+		Registration registrationResponse `json:"registration"`
+	}{}
+	if _, err := client.post(ctx, "/registration/new", registration, &results); err != nil {
+		return nil, err
+	}
+	if !results.Registration.Status.IsOK() {
+		log.Errorf("Failed to register web user %s", registration.Login, results.Registration.Status)
+		return nil, results.Registration.Status.AsError()
+	}
+	log.Infof("Registered web user %s", registration.Login)
+	return &Identity{
+		Login:       registration.Login,
+		Name:        registration.Name,
+		Contact:     registration.Contact,
+		credentials: registration.Password,
+	}, nil
+}
+
+// Login authenticates a registered web user on PureConnect and gives its Identity
+//
+// If the login or the password is wrong, an error matching StatusInvalidCredentials is returned.
+func (client *Client) Login(ctx context.Context, login, password string) (*Identity, error) {
+	log := client.Logger.Child("registration", "login")
+	if len(login) == 0 {
+		return nil, errors.ArgumentMissing.With("login")
+	}
+
+	log.Debugf("Authenticating web user %s", login)
+	results := struct {
+		Registration registrationResponse `json:"registration"`
+	}{}
+	_, err := client.post(ctx, "/registration/login", struct {
+		Login    string `json:"userID"`
+		Password string `json:"password"`
+	}{login, password}, &results)
+	if err != nil {
+		return nil, err
+	}
+	if !results.Registration.Status.IsOK() {
+		log.Errorf("Failed to authenticate web user %s", login, results.Registration.Status)
+		return nil, results.Registration.Status.AsError()
+	}
+	return &Identity{
+		Login:       login,
+		Name:        results.Registration.Name,
+		Contact:     results.Registration.Contact,
+		credentials: password,
+	}, nil
+}
+
+// String gives the login of the identity
+func (identity *Identity) String() string {
+	return identity.Login
+}
+
+// authenticate gives the participant to send to PureConnect for the given guest, authenticated as this identity
+//
+// The Guest keeps their ID, PureConnect knows them by their login.
+func (identity *Identity) authenticate(guest Participant) Participant {
+	guest.Name = identity.Login
+	guest.Credentials = identity.credentials
+	return guest
+}
@@ -0,0 +1,90 @@
+package iwt_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanRegisterUser(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+
+	identity, err := client.RegisterUser(context.Background(), iwt.UserRegistration{
+		Name:     "John Doe",
+		Login:    "jdoe",
+		Password: "s3cr3t",
+		Contact:  iwt.ContactInfo{EmailAddress: "john.doe@acme.com", Telephone: "+81-3-1234-5678"},
+	})
+	require.Nil(t, err, "Failed to register the user, Error: %s", err)
+	assert.Equal(t, "jdoe", identity.Login)
+	assert.Equal(t, "John Doe", identity.Name)
+	require.NotNil(t, server.User("jdoe"))
+	assert.Equal(t, "john.doe@acme.com", server.User("jdoe").Contact["emailAddress"])
+
+	payload, err := json.Marshal(identity)
+	require.Nil(t, err, "Failed to marshal the identity, Error: %s", err)
+	assert.NotContains(t, string(payload), "s3cr3t", "The credentials should not be encoded")
+
+	_, err = client.RegisterUser(context.Background(), iwt.UserRegistration{Name: "Jane Doe", Login: "jdoe", Password: "other"})
+	assert.ErrorIs(t, err, iwt.StatusDuplicateLogin)
+
+	_, err = client.RegisterUser(context.Background(), iwt.UserRegistration{Name: "Jane Doe", Login: "jane"})
+	assert.NotNil(t, err, "The password should be required")
+}
+
+func TestCanLogin(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.AddUser("jdoe", "s3cr3t", "John Doe")
+
+	identity, err := client.Login(context.Background(), "jdoe", "s3cr3t")
+	require.Nil(t, err, "Failed to login, Error: %s", err)
+	assert.Equal(t, "jdoe", identity.Login)
+	assert.Equal(t, "John Doe", identity.Name)
+
+	_, err = client.Login(context.Background(), "jdoe", "wrong")
+	assert.ErrorIs(t, err, iwt.StatusInvalidCredentials)
+	_, err = client.Login(context.Background(), "nobody", "s3cr3t")
+	assert.ErrorIs(t, err, iwt.StatusInvalidCredentials)
+}
+
+func TestCanStartAuthenticatedChat(t *testing.T) {
+	server, client := newTestFixture(t, iwt.ClientOptions{})
+	server.AddUser("jdoe", "s3cr3t", "John Doe")
+
+	identity, err := client.Login(context.Background(), "jdoe", "s3cr3t")
+	require.Nil(t, err, "Failed to login, Error: %s", err)
+	chat, err := client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:    iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest:    iwt.Participant{ID: "U001"},
+		Identity: identity,
+	})
+	require.Nil(t, err, "Failed to start the chat, Error: %s", err)
+	defer chat.Stop(context.Background())
+	assert.Equal(t, "John Doe", chat.Guest.Name)
+	assert.Equal(t, "U001", chat.Guest.ID)
+	assert.Empty(t, chat.Guest.Credentials, "The chat should not keep the credentials")
+	serverChat := server.Chat(chat.ID)
+	require.NotNil(t, serverChat)
+	assert.Equal(t, "John Doe", serverChat.GuestName)
+
+	callback, err := client.CreateCallback(context.Background(), iwt.CreateCallbackOptions{
+		Queue:     iwt.NewQueue("Workgroup Queue:Sales"),
+		Telephone: "+81-3-1234-5678",
+		Identity:  identity,
+	})
+	require.Nil(t, err, "Failed to create the callback, Error: %s", err)
+	assert.Equal(t, "John Doe", callback.Guest.Name)
+
+	identity, err = client.RegisterUser(context.Background(), iwt.UserRegistration{Name: "Jane Doe", Login: "jane", Password: "pass"})
+	require.Nil(t, err, "Failed to register the user, Error: %s", err)
+	server.AddUser("jane", "changed", "Jane Doe")
+	_, err = client.StartChat(context.Background(), iwt.StartChatOptions{
+		Queue:    iwt.NewQueue("Workgroup Queue:Sales"),
+		Identity: identity,
+	})
+	assert.ErrorIs(t, err, iwt.StatusInvalidCredentials)
+}
@@ -1,26 +1,86 @@
 package iwt
 
 import (
-	"fmt"
+	"context"
 )
 
 // ServerConfiguration contains information about a PureConnect server
 type ServerConfiguration struct {
-	Version      int                 `json:"cfgVer"`
-	Capabilities map[string][]string `json:"capabilities"`
+	Version          int                 `json:"cfgVer"`
+	Capabilities     map[string][]string `json:"capabilities"`
+	MaxMessageLength int                 `json:"maxMessageLength,omitempty"` // 0 means no limit
 }
 
 // GetServerConfiguration fetches the configuration of the PureConnect server
-func (client *Client) GetServerConfiguration() (*ServerConfiguration, error) {
+//
+// The configuration is kept by the Client to negotiate the content types of the chats it starts,
+// until the Client switches to another API endpoint.
+func (client *Client) GetServerConfiguration(ctx context.Context) (*ServerConfiguration, error) {
 	results := []struct {
-		Config ServerConfiguration `json:"serverConfiguration"`
+		Config struct {
+			ServerConfiguration
+			Status Status `json:"status"`
+		} `json:"serverConfiguration"`
 	}{}
-	if _, err := client.get("/serverConfiguration", &results); err != nil {
+	endpoint := client.CurrentAPIEndpoint()
+	if _, err := client.get(ctx, "/serverConfiguration", &results); err != nil {
 		return nil, err
 	}
 	if len(results) == 0 {
-		return nil, fmt.Errorf("Failed to query")
+		return nil, StatusUnavailableService
 	}
+	if status := results[0].Config.Status; len(status.Type) > 0 && !status.IsOK() {
+		return nil, status
+	}
+
+	configuration := results[0].Config.ServerConfiguration
+	client.mutex.Lock()
+	if client.APIEndpoints[client.EndPointIndex] == endpoint {
+		client.configuration = &configuration
+	}
+	client.mutex.Unlock()
+	return &configuration, nil
+}
 
-	return &results[0].Config, nil
+// ContentTypes gives the content types the server supports for chat messages
+//
+// If the server does not advertise any, only text/plain is supported.
+func (config ServerConfiguration) ContentTypes() []string {
+	if contentTypes, found := config.Capabilities["contentTypes"]; found && len(contentTypes) > 0 {
+		return contentTypes
+	}
+	return []string{PlainTextContentType}
+}
+
+// Languages gives the languages the server supports for chats and callbacks (BCP-47 language tags)
+//
+// If the server does not advertise any, the languages are not negotiated.
+func (config ServerConfiguration) Languages() []string {
+	return config.Capabilities["languages"]
+}
+
+// serverConfiguration gives the configuration of the PureConnect server, fetching it once per API endpoint
+func (client *Client) serverConfiguration(ctx context.Context) (*ServerConfiguration, error) {
+	client.mutex.RLock()
+	configuration := client.configuration
+	client.mutex.RUnlock()
+	if configuration != nil {
+		return configuration, nil
+	}
+	return client.GetServerConfiguration(ctx)
+}
+
+// HasCapability tells if the server advertises the given capability (e.g.: "chat", "sendFile")
+func (config ServerConfiguration) HasCapability(feature, capability string) bool {
+	return containsFold(config.Capabilities[feature], capability)
+}
+
+// supportsCapability tells if the PureConnect server advertises the given capability
+func (client *Client) supportsCapability(ctx context.Context, feature, capability string) bool {
+	config, err := client.serverConfiguration(ctx)
+	if err != nil {
+		client.Logger.Warnf("Failed to fetch the server configuration, assuming %s/%s is not supported: %s", feature, capability, err)
+		return false
+	}
+	return config.HasCapability(feature, capability)
 }
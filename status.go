@@ -1,11 +1,17 @@
 package iwt
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/gildas/go-errors"
 )
 
 // Status defines the status of a queue, chat, IWT request
+//
+// A failed Status is an error that can be matched with errors.Is against the Status catalog below
+// (e.g. errors.Is(err, StatusUnknownEntitySession)), its Params are kept.
 type Status struct {
 	Type   string                 `json:"type"`
 	Reason string                 `json:"reason"`
@@ -15,12 +21,48 @@ type Status struct {
 var (
 	// StatusUnknownEntitySession means the provided session does not exist on the PureConnect Server
 	StatusUnknownEntitySession = Status{"failure", "error.websvc.unknownEntity.session", nil}
+	// StatusUnknownEntityQueue means the queue does not exist on the PureConnect Server
+	StatusUnknownEntityQueue = Status{"failure", "error.websvc.unknownEntity.invalidQueue", nil}
+	// StatusUnknownEntityParticipant means the participant does not exist on the PureConnect Server
+	StatusUnknownEntityParticipant = Status{"failure", "error.websvc.unknownEntity.participant", nil}
 	// StatusNotConnectedEntity means the client is not connected to any PureConnect Server
 	StatusNotConnectedEntity = Status{"failure", "error.websvc.entity.notconnected", nil}
 	// StatusUnavailableService means the PureConnect Server is not available for requests
 	StatusUnavailableService = Status{"failure", "error.websvc.unavailable", nil}
+	// StatusInvalidParticipant means the participant given in the request is not valid
+	StatusInvalidParticipant = Status{"failure", "error.websvc.content.invalid.participant", nil}
+	// StatusContentTooLong means the content of the request is too long (e.g. a message)
+	StatusContentTooLong = Status{"failure", "error.websvc.content.invalid.tooLong", nil}
+	// StatusContentMissing means the request is missing some data
+	StatusContentMissing = Status{"failure", "error.websvc.content.invalid.missingData", nil}
+	// StatusInvalidContentType means the content type of the request is not supported
+	StatusInvalidContentType = Status{"failure", "error.websvc.content.invalid.contentType", nil}
+	// StatusUnsupportedRequest means the PureConnect Server does not support the request
+	StatusUnsupportedRequest = Status{"failure", "error.websvc.unsupportedRequest", nil}
+	// StatusNotAuthorized means the web user is not authorized to perform the request
+	StatusNotAuthorized = Status{"failure", "error.websvc.notAuthorized", nil}
+	// StatusDuplicateLogin means a web user is already registered with the same login
+	StatusDuplicateLogin = Status{"failure", "error.websvc.registration.duplicateUserID", nil}
+	// StatusInvalidCredentials means the login or the password of the web user is wrong
+	StatusInvalidCredentials = Status{"failure", "error.websvc.authentication.invalidCredentials", nil}
+	// StatusUnknownError means the PureConnect Server failed for an unknown reason
+	StatusUnknownError = Status{"failure", "error.websvc.unknown", nil}
 )
 
+// retryableStatuses are the failures that can succeed if the request is sent again
+var retryableStatuses = []Status{
+	StatusUnavailableService,
+	StatusUnknownError,
+}
+
+// fatalStatuses are the failures after which the chat or the callback cannot continue
+var fatalStatuses = []Status{
+	StatusUnknownEntitySession,
+	StatusNotConnectedEntity,
+	StatusInvalidParticipant,
+	StatusNotAuthorized,
+}
+
 // IsOK tells if the status is a success
 func (status Status) IsOK() bool {
 	return status.Type == "success"
@@ -31,19 +73,55 @@ func (status Status) IsA(ref Status) bool {
 	return status.Type == ref.Type && status.Reason == ref.Reason
 }
 
+// IsRetryable tells if the request that failed with this status can be sent again
+func (status Status) IsRetryable() bool {
+	for _, retryable := range retryableStatuses {
+		if status.IsA(retryable) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFatal tells if the chat or callback that failed with this status cannot continue
+func (status Status) IsFatal() bool {
+	for _, fatal := range fatalStatuses {
+		if status.IsA(fatal) {
+			return true
+		}
+	}
+	return false
+}
+
 // AsError converts a status to a GO error
+//
+// returns nil if the status is a success
 func (status Status) AsError() error {
 	if status.IsOK() {
 		return nil
 	}
-	return fmt.Errorf(status.Reason)
+	return status
+}
+
+// Is tells if this status matches the target error (used by errors.Is)
+//
+// Params are not compared.
+func (status Status) Is(target error) bool {
+	switch ref := target.(type) {
+	case Status:
+		return status.IsA(ref)
+	case *Status:
+		return ref != nil && status.IsA(*ref)
+	}
+	return false
 }
 
 // Param adds a param
 func (status Status) Param(key string, value interface{}) Status {
 	final := status
-	if len(final.Params) == 0 {
-		final.Params = map[string]interface{}{}
+	final.Params = make(map[string]interface{}, len(status.Params)+1)
+	for k, v := range status.Params {
+		final.Params[k] = v
 	}
 	final.Params[key] = value
 	return final
@@ -73,3 +151,31 @@ func (status Status) Error() string {
 	}
 	return status.Reason
 }
+
+// IsRetryable tells if the request that failed with the given error can be sent again
+//
+// The error can be a Status, a timeout, or an HTTP error that denotes a temporary condition (502, 503, 504, 429)
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status Status
+	if errors.As(err, &status) {
+		return status.IsRetryable()
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, errors.HTTPBadGateway) ||
+		errors.Is(err, errors.HTTPServiceUnavailable) ||
+		errors.Is(err, errors.HTTPStatusGatewayTimeout) ||
+		errors.Is(err, errors.HTTPStatusTooManyRequests) ||
+		errors.Is(err, errors.HTTPStatusRequestTimeout)
+}
+
+// IsFatal tells if the chat or callback that failed with the given error cannot continue
+func IsFatal(err error) bool {
+	var status Status
+	if errors.As(err, &status) {
+		return status.IsFatal()
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package iwt
+
+import (
+	"sync"
+
+	"github.com/gildas/go-errors"
+	"golang.org/x/text/language"
+)
+
+// statusMessages are the messages that describe the Status reasons to the web users, indexed by language, then by reason
+var statusMessages = map[string]map[string]string{
+	"en": {
+		StatusUnknownEntitySession.Reason:     "Your conversation has ended. Please start a new one.",
+		StatusUnknownEntityQueue.Reason:       "This service is not available at the moment.",
+		StatusUnknownEntityParticipant.Reason: "This person is no longer in the conversation.",
+		StatusNotConnectedEntity.Reason:       "You are not connected. Please start a new conversation.",
+		StatusUnavailableService.Reason:       "Our service is temporarily unavailable. Please try again in a few moments.",
+		StatusInvalidParticipant.Reason:       "You are not part of this conversation anymore.",
+		StatusContentTooLong.Reason:           "Your message is too long. Please send a shorter one.",
+		StatusContentMissing.Reason:           "Your message is empty.",
+		StatusInvalidContentType.Reason:       "This type of content cannot be sent.",
+		StatusUnsupportedRequest.Reason:       "This action is not supported.",
+		StatusNotAuthorized.Reason:            "You are not allowed to do this.",
+		StatusDuplicateLogin.Reason:           "This login is already used. Please choose another one.",
+		StatusInvalidCredentials.Reason:       "The login or the password is incorrect.",
+		StatusUnknownError.Reason:             "Something went wrong. Please try again later.",
+	},
+	"fr": {
+		StatusUnknownEntitySession.Reason:     "Votre conversation est terminée. Veuillez en commencer une nouvelle.",
+		StatusUnknownEntityQueue.Reason:       "Ce service n'est pas disponible pour le moment.",
+		StatusUnknownEntityParticipant.Reason: "Cette personne ne participe plus à la conversation.",
+		StatusNotConnectedEntity.Reason:       "Vous n'êtes pas connecté. Veuillez commencer une nouvelle conversation.",
+		StatusUnavailableService.Reason:       "Notre service est momentanément indisponible. Veuillez réessayer dans quelques instants.",
+		StatusInvalidParticipant.Reason:       "Vous ne participez plus à cette conversation.",
+		StatusContentTooLong.Reason:           "Votre message est trop long. Veuillez en envoyer un plus court.",
+		StatusContentMissing.Reason:           "Votre message est vide.",
+		StatusInvalidContentType.Reason:       "Ce type de contenu ne peut pas être envoyé.",
+		StatusUnsupportedRequest.Reason:       "Cette action n'est pas prise en charge.",
+		StatusNotAuthorized.Reason:            "Vous n'êtes pas autorisé à faire cela.",
+		StatusDuplicateLogin.Reason:           "Cet identifiant est déjà utilisé. Veuillez en choisir un autre.",
+		StatusInvalidCredentials.Reason:       "L'identifiant ou le mot de passe est incorrect.",
+		StatusUnknownError.Reason:             "Une erreur s'est produite. Veuillez réessayer plus tard.",
+	},
+	"de": {
+		StatusUnknownEntitySession.Reason:     "Ihre Unterhaltung wurde beendet. Bitte beginnen Sie eine neue.",
+		StatusUnknownEntityQueue.Reason:       "Dieser Dienst ist derzeit nicht verfügbar.",
+		StatusUnknownEntityParticipant.Reason: "Diese Person nimmt nicht mehr an der Unterhaltung teil.",
+		StatusNotConnectedEntity.Reason:       "Sie sind nicht verbunden. Bitte beginnen Sie eine neue Unterhaltung.",
+		StatusUnavailableService.Reason:       "Unser Dienst ist vorübergehend nicht verfügbar. Bitte versuchen Sie es in Kürze erneut.",
+		StatusInvalidParticipant.Reason:       "Sie nehmen nicht mehr an dieser Unterhaltung teil.",
+		StatusContentTooLong.Reason:           "Ihre Nachricht ist zu lang. Bitte senden Sie eine kürzere.",
+		StatusContentMissing.Reason:           "Ihre Nachricht ist leer.",
+		StatusInvalidContentType.Reason:       "Dieser Inhaltstyp kann nicht gesendet werden.",
+		StatusUnsupportedRequest.Reason:       "Diese Aktion wird nicht unterstützt.",
+		StatusNotAuthorized.Reason:            "Sie sind dazu nicht berechtigt.",
+		StatusDuplicateLogin.Reason:           "Dieser Benutzername wird bereits verwendet. Bitte wählen Sie einen anderen.",
+		StatusInvalidCredentials.Reason:       "Der Benutzername oder das Passwort ist falsch.",
+		StatusUnknownError.Reason:             "Etwas ist schiefgelaufen. Bitte versuchen Sie es später erneut.",
+	},
+	"es": {
+		StatusUnknownEntitySession.Reason:     "Su conversación ha terminado. Por favor, inicie una nueva.",
+		StatusUnknownEntityQueue.Reason:       "Este servicio no está disponible en este momento.",
+		StatusUnknownEntityParticipant.Reason: "Esta persona ya no está en la conversación.",
+		StatusNotConnectedEntity.Reason:       "No está conectado. Por favor, inicie una nueva conversación.",
+		StatusUnavailableService.Reason:       "Nuestro servicio no está disponible temporalmente. Por favor, inténtelo de nuevo en unos momentos.",
+		StatusInvalidParticipant.Reason:       "Ya no forma parte de esta conversación.",
+		StatusContentTooLong.Reason:           "Su mensaje es demasiado largo. Por favor, envíe uno más corto.",
+		StatusContentMissing.Reason:           "Su mensaje está vacío.",
+		StatusInvalidContentType.Reason:       "Este tipo de contenido no se puede enviar.",
+		StatusUnsupportedRequest.Reason:       "Esta acción no está disponible.",
+		StatusNotAuthorized.Reason:            "No tiene permiso para hacer esto.",
+		StatusDuplicateLogin.Reason:           "Este usuario ya existe. Por favor, elija otro.",
+		StatusInvalidCredentials.Reason:       "El usuario o la contraseña son incorrectos.",
+		StatusUnknownError.Reason:             "Algo salió mal. Por favor, inténtelo más tarde.",
+	},
+	"ja": {
+		StatusUnknownEntitySession.Reason:     "チャットは終了しました。新しいチャットを開始してください。",
+		StatusUnknownEntityQueue.Reason:       "このサービスは現在ご利用いただけません。",
+		StatusUnknownEntityParticipant.Reason: "この参加者はすでにチャットから退出しています。",
+		StatusNotConnectedEntity.Reason:       "接続されていません。新しいチャットを開始してください。",
+		StatusUnavailableService.Reason:       "サービスが一時的にご利用いただけません。しばらくしてから再度お試しください。",
+		StatusInvalidParticipant.Reason:       "このチャットにはもう参加していません。",
+		StatusContentTooLong.Reason:           "メッセージが長すぎます。短くして送信してください。",
+		StatusContentMissing.Reason:           "メッセージが空です。",
+		StatusInvalidContentType.Reason:       "この種類のコンテンツは送信できません。",
+		StatusUnsupportedRequest.Reason:       "この操作はサポートされていません。",
+		StatusNotAuthorized.Reason:            "この操作を行う権限がありません。",
+		StatusDuplicateLogin.Reason:           "このログインIDはすでに使用されています。別のIDを選んでください。",
+		StatusInvalidCredentials.Reason:       "ログインIDまたはパスワードが正しくありません。",
+		StatusUnknownError.Reason:             "エラーが発生しました。後ほど再度お試しください。",
+	},
+}
+
+// statusMessagesMutex protects statusMessages
+var statusMessagesMutex sync.RWMutex
+
+// AddStatusMessages adds messages to the catalog used by Status.Message and LocalizedMessage
+//
+// The messages are indexed by Status reason (e.g. "error.websvc.unavailable"), they replace the existing ones.
+// The language is a BCP-47 language tag (e.g. "pt-BR").
+func AddStatusMessages(lang string, messages map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return errors.ArgumentInvalid.With("language", lang)
+	}
+	statusMessagesMutex.Lock()
+	defer statusMessagesMutex.Unlock()
+	catalog, found := statusMessages[tag.String()]
+	if !found {
+		catalog = map[string]string{}
+		statusMessages[tag.String()] = catalog
+	}
+	for reason, message := range messages {
+		catalog[reason] = message
+	}
+	return nil
+}
+
+// Message gives a message that describes the status to the web user, in the given language
+//
+// The language is a BCP-47 language tag or a list of them as in Accept-Language (e.g. "fr-CA, fr;q=0.9").
+// If the catalog has no message in that language, the English message is given.
+// Statuses that are not in the catalog are described as StatusUnknownError.
+func (status Status) Message(lang string) string {
+	statusMessagesMutex.RLock()
+	defer statusMessagesMutex.RUnlock()
+	catalog := statusMessages[catalogLanguage(lang)]
+	for _, message := range []string{catalog[status.Reason], statusMessages["en"][status.Reason], catalog[StatusUnknownError.Reason], statusMessages["en"][StatusUnknownError.Reason]} {
+		if len(message) > 0 {
+			return message
+		}
+	}
+	return status.Reason
+}
+
+// LocalizedMessage gives a message that describes the error to the web user, in the given language (see Status.Message)
+//
+// Errors that are not a Status are described as StatusUnknownError.
+func LocalizedMessage(err error, lang string) string {
+	if err == nil {
+		return ""
+	}
+	var status Status
+	if errors.As(err, &status) {
+		return status.Message(lang)
+	}
+	return StatusUnknownError.Message(lang)
+}
+
+// catalogLanguage gives the language of the catalog that best matches the given language, the caller must hold statusMessagesMutex
+func catalogLanguage(lang string) string {
+	wanted, err := parseLanguages(lang)
+	if err != nil || len(wanted) == 0 {
+		return "en"
+	}
+	supported := make([]string, 0, len(statusMessages))
+	tags := make([]language.Tag, 0, len(statusMessages))
+	for catalog := range statusMessages {
+		supported = append(supported, catalog)
+		tags = append(tags, language.MustParse(catalog))
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(wanted...)
+	if confidence == language.No {
+		return "en"
+	}
+	return supported[index]
+}
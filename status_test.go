@@ -0,0 +1,81 @@
+package iwt_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-iwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuccessStatusIsNotAnError(t *testing.T) {
+	status := iwt.Status{Type: "success"}
+	assert.Nil(t, status.AsError())
+}
+
+func TestStatusCanMatchSentinel(t *testing.T) {
+	status := iwt.Status{Type: "failure", Reason: "error.websvc.unknownEntity.session"}
+	err := status.Param("id", "1234").AsError()
+	require.NotNil(t, err)
+	assert.ErrorIs(t, err, iwt.StatusUnknownEntitySession)
+	assert.NotErrorIs(t, err, iwt.StatusUnavailableService)
+
+	wrapped := fmt.Errorf("Failed to poll: %w", err)
+	assert.ErrorIs(t, wrapped, iwt.StatusUnknownEntitySession)
+	wrapped = errors.RuntimeError.Wrap(err)
+	assert.ErrorIs(t, wrapped, iwt.StatusUnknownEntitySession)
+}
+
+func TestStatusKeepsParams(t *testing.T) {
+	err := iwt.StatusContentTooLong.Param("id", "1234").AsError()
+	assert.Equal(t, "error.websvc.content.invalid.tooLong(id: 1234)", err.Error())
+
+	var status iwt.Status
+	require.ErrorAs(t, fmt.Errorf("Failed to send: %w", err), &status)
+	assert.Equal(t, "1234", status.Params["id"])
+	assert.Empty(t, iwt.StatusContentTooLong.Params, "Param should not modify the sentinel")
+}
+
+func TestCanClassifyErrors(t *testing.T) {
+	assert.True(t, iwt.IsRetryable(iwt.StatusUnavailableService.Param("id", "1234")))
+	assert.True(t, iwt.IsRetryable(errors.HTTPServiceUnavailable.Clone()))
+	assert.True(t, iwt.IsRetryable(context.DeadlineExceeded))
+	assert.False(t, iwt.IsRetryable(iwt.StatusUnknownEntitySession))
+	assert.False(t, iwt.IsRetryable(nil))
+
+	assert.True(t, iwt.IsFatal(fmt.Errorf("Failed to poll: %w", iwt.StatusUnknownEntitySession)))
+	assert.True(t, iwt.IsFatal(iwt.StatusNotConnectedEntity))
+	assert.False(t, iwt.IsFatal(iwt.StatusUnavailableService))
+	assert.False(t, iwt.IsFatal(errors.HTTPServiceUnavailable.Clone()))
+}
+
+func TestCanLocalizeStatusMessages(t *testing.T) {
+	assert.Equal(t, "Your message is too long. Please send a shorter one.", iwt.StatusContentTooLong.Message("en-US"))
+	assert.Equal(t, "Votre message est trop long. Veuillez en envoyer un plus court.", iwt.StatusContentTooLong.Message("fr-CA"))
+	assert.Equal(t, "メッセージが長すぎます。短くして送信してください。", iwt.StatusContentTooLong.Message("ja, en;q=0.5"))
+	assert.Equal(t, "Your message is too long. Please send a shorter one.", iwt.StatusContentTooLong.Message("ko"), "Unknown languages should fall back to English")
+	assert.Equal(t, "Your message is too long. Please send a shorter one.", iwt.StatusContentTooLong.Message(""))
+
+	unknown := iwt.Status{Type: "failure", Reason: "error.websvc.something.new"}
+	assert.Equal(t, iwt.StatusUnknownError.Message("de"), unknown.Message("de"))
+
+	err := fmt.Errorf("Failed to send: %w", iwt.StatusUnavailableService.Param("id", "1234").AsError())
+	assert.Equal(t, iwt.StatusUnavailableService.Message("es"), iwt.LocalizedMessage(err, "es-MX"))
+	assert.Equal(t, iwt.StatusUnknownError.Message("fr"), iwt.LocalizedMessage(context.Canceled, "fr"))
+	assert.Empty(t, iwt.LocalizedMessage(nil, "fr"))
+}
+
+func TestCanAddStatusMessages(t *testing.T) {
+	err := iwt.AddStatusMessages("pt-BR", map[string]string{
+		iwt.StatusContentTooLong.Reason: "Sua mensagem é muito longa.",
+	})
+	require.Nil(t, err, "Failed to add messages, Error: %s", err)
+	assert.Equal(t, "Sua mensagem é muito longa.", iwt.StatusContentTooLong.Message("pt-BR"))
+	assert.Equal(t, iwt.StatusNotAuthorized.Message("en"), iwt.StatusNotAuthorized.Message("pt-BR"), "Missing messages should fall back to English")
+
+	err = iwt.AddStatusMessages("not a language!", map[string]string{})
+	assert.ErrorIs(t, err, errors.ArgumentInvalid)
+}
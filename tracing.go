@@ -0,0 +1,77 @@
+package iwt
+
+import (
+	"context"
+
+	"github.com/gildas/go-errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the OpenTelemetry tracer of the Client, i.e. the instrumentation scope
+const tracerName = "github.com/gildas/go-iwt"
+
+// The attributes of the OpenTelemetry spans
+const (
+	ChatIDAttribute        = attribute.Key("iwt.chat.id")
+	ParticipantIDAttribute = attribute.Key("iwt.participant.id")
+	QueueAttribute         = attribute.Key("iwt.queue")
+	StatusReasonAttribute  = attribute.Key("iwt.status.reason")
+)
+
+// startSpan starts an OpenTelemetry span as a child of the span in the context, if any
+func (client *Client) startSpan(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return client.tracer.Start(ctx, name, options...)
+}
+
+// endSpan records the outcome of the operation in the span and ends it
+//
+// The reason of a failed Status is given as the StatusReasonAttribute.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		var status Status
+		if errors.As(err, &status) && len(status.Reason) > 0 {
+			span.SetAttributes(StatusReasonAttribute.String(status.Reason))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanAttributes gives the attributes of the spans of the chat
+func (chat *Chat) spanAttributes() []attribute.KeyValue {
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	attributes := []attribute.KeyValue{ChatIDAttribute.String(chat.ID)}
+	if len(chat.Participants) > 0 {
+		attributes = append(attributes, ParticipantIDAttribute.String(chat.Participants[0].ID))
+	}
+	if chat.Queue != nil {
+		attributes = append(attributes, QueueAttribute.String(chat.Queue.String()))
+	}
+	return attributes
+}
+
+// startSpan starts an OpenTelemetry span for an operation of the chat
+func (chat *Chat) startSpan(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return chat.Client.startSpan(ctx, name, append(options, trace.WithAttributes(chat.spanAttributes()...))...)
+}
+
+// startLink links a span to the StartChat span of the chat, if the chat was started with one
+//
+// The polls happen outside of the context given to StartChat, the link relates them to the trace of the chat.
+func (chat *Chat) startLink() []trace.SpanStartOption {
+	if !chat.spanContext.IsValid() {
+		return nil
+	}
+	return []trace.SpanStartOption{trace.WithLinks(trace.Link{SpanContext: chat.spanContext})}
+}
+
+// injectTraceContext adds the trace context of the context to the headers of a request, with the global propagator
+func injectTraceContext(ctx context.Context, headers map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+}
@@ -0,0 +1,108 @@
+package iwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-iwt"
+	"github.com/gildas/go-iwt/iwttest"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func findSpans(recorder *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	spans := []sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, value := range span.Attributes() {
+		if value.Key == key {
+			return value.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestCanTraceChat(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	server := iwttest.NewServer()
+	defer server.Close()
+	server.AddQueue("Sales", "Workgroup", 1, 0)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client, err := iwt.NewClient(context.Background(), iwt.ClientOptions{
+		PrimaryAPI:     server.APIURL(),
+		RetryPolicy:    &iwt.NoRetry,
+		TracerProvider: provider,
+		Logger:         logger.Create("test", &logger.NilStream{}),
+	})
+	require.Nil(t, err, "Failed to instantiate a new IWT Client, Error: %s", err)
+
+	ctx, caller := provider.Tracer("test").Start(context.Background(), "caller")
+	chat, err := client.StartChat(ctx, iwt.StartChatOptions{
+		Queue: iwt.NewQueue("Workgroup Queue:Sales"),
+		Guest: iwt.Participant{ID: "U001", Name: "John Doe"},
+	})
+	require.Nil(t, err, "Failed to start the chat, Error: %s", err)
+	chatID := chat.String()
+	participantID := server.Chat(chatID).WebUserID
+
+	require.Nil(t, chat.SendText(ctx, "Hello"))
+	server.Fail("/chat/sendMessage", iwttest.StatusContentTooLong, 1)
+	require.NotNil(t, chat.SendText(ctx, "Hello again"))
+	_, _ = client.QueryQueue(ctx, "Sales", iwt.WorkgroupQueue)
+	time.Sleep(1500 * time.Millisecond) // at least one poll
+	require.Nil(t, chat.Reconnect(ctx))
+	require.Nil(t, chat.Stop(ctx))
+	caller.End()
+
+	starts := findSpans(recorder, "iwt.StartChat")
+	require.Len(t, starts, 1)
+	start := starts[0]
+	assert.Equal(t, caller.SpanContext().SpanID(), start.Parent().SpanID(), "StartChat should be a child of the caller span")
+	assert.Equal(t, chatID, spanAttribute(start, iwt.ChatIDAttribute))
+	assert.Equal(t, participantID, spanAttribute(start, iwt.ParticipantIDAttribute))
+	assert.Equal(t, "Workgroup Queue:Sales", spanAttribute(start, iwt.QueueAttribute))
+	assert.Equal(t, codes.Unset, start.Status().Code)
+
+	requests := server.RequestsTo("/chat/start")
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0].Header.Get("traceparent"), caller.SpanContext().TraceID().String(), "The trace context should be sent to PureConnect")
+
+	messages := findSpans(recorder, "iwt.SendMessage")
+	require.Len(t, messages, 2)
+	assert.Equal(t, chatID, spanAttribute(messages[0], iwt.ChatIDAttribute))
+	assert.Equal(t, codes.Unset, messages[0].Status().Code)
+	assert.Equal(t, codes.Error, messages[1].Status().Code)
+	assert.Equal(t, iwt.StatusContentTooLong.Reason, spanAttribute(messages[1], iwt.StatusReasonAttribute))
+
+	polls := findSpans(recorder, "iwt.Poll")
+	require.NotEmpty(t, polls)
+	assert.Equal(t, participantID, spanAttribute(polls[0], iwt.ParticipantIDAttribute))
+	require.Len(t, polls[0].Links(), 1, "Polls should be linked to the StartChat span")
+	assert.Equal(t, start.SpanContext().SpanID(), polls[0].Links()[0].SpanContext.SpanID())
+
+	for _, name := range []string{"iwt.QueryQueue", "iwt.Reconnect", "iwt.Stop"} {
+		spans := findSpans(recorder, name)
+		require.Len(t, spans, 1, "There should be a %s span", name)
+		assert.Equal(t, caller.SpanContext().TraceID(), spans[0].SpanContext().TraceID(), "%s should be in the caller trace", name)
+	}
+	assert.Equal(t, "Workgroup Queue:Sales", spanAttribute(findSpans(recorder, "iwt.QueryQueue")[0], iwt.QueueAttribute))
+}